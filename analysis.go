@@ -0,0 +1,83 @@
+package gistdecoder
+
+// isFullScan reports whether n is a scan with no span constraint.
+func isFullScan(n *Node) bool {
+	if n == nil || n.op != scanOp {
+		return false
+	}
+	fullScan, _ := n.args["full_scan"].(bool)
+	return fullScan
+}
+
+// HasFullScan reports whether any scan in the plan reads its whole table or
+// index, i.e. has neither a regular nor an inverted span constraint.
+//
+// Index joins and lookup joins are not considered: the gist does not record
+// how many rows they read, so a full index read through them is not
+// detectable from the decoded plan.
+func HasFullScan(n *Node) bool {
+	found := false
+	Walk(n, func(node *Node) bool {
+		if isFullScan(node) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// FullScanTables returns the IDs of the tables read by full scans, in the
+// order they are first encountered in a pre-order traversal. Each table is
+// listed once even if it is fully scanned several times.
+func FullScanTables(n *Node) []int64 {
+	var tables []int64
+	seen := make(map[int64]bool)
+	Walk(n, func(node *Node) bool {
+		if !isFullScan(node) {
+			return true
+		}
+		if id, ok := node.args["table_id"].(int64); ok && !seen[id] {
+			seen[id] = true
+			tables = append(tables, id)
+		}
+		return true
+	})
+	return tables
+}
+
+// SortAfterFullScan returns the sort and top-k nodes whose input reads a
+// full scan with no limit in between, i.e. plans that sort an entire table.
+// Scans that carry their own hard limit are not considered whole-table reads.
+func SortAfterFullScan(n *Node) []*Node {
+	var flagged []*Node
+	Walk(n, func(node *Node) bool {
+		if node.op == sortOp || node.op == topKOp {
+			for _, child := range node.children {
+				if readsUnlimitedFullScan(child) {
+					flagged = append(flagged, node)
+					break
+				}
+			}
+		}
+		return true
+	})
+	return flagged
+}
+
+// readsUnlimitedFullScan reports whether the subtree rooted at n contains a
+// full scan without a hard limit that is not bounded by a limit or top-k.
+func readsUnlimitedFullScan(n *Node) bool {
+	found := false
+	Walk(n, func(node *Node) bool {
+		if found || node.op == limitOp || node.op == topKOp {
+			return false
+		}
+		if isFullScan(node) {
+			if _, limited := node.args["hard_limit"]; !limited {
+				found = true
+			}
+		}
+		return true
+	})
+	return found
+}
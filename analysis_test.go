@@ -0,0 +1,66 @@
+package gistdecoder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHasFullScan(t *testing.T) {
+	full := mustDecode(t, newGistBuilder().
+		scan(112, 1, 1, 0, 0).
+		scan(113, 1, 0, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		scan(113, 2, 0, 0, 0).
+		op(unionAllOp).
+		String())
+
+	if !HasFullScan(full) {
+		t.Error("Expected full scan to be detected")
+	}
+	if got, want := FullScanTables(full), []int64{113}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected full scan tables %v, got %v", want, got)
+	}
+}
+
+func TestHasFullScanConstrained(t *testing.T) {
+	constrained := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+
+	if HasFullScan(constrained) {
+		t.Error("Expected no full scan in a constrained plan")
+	}
+	if tables := FullScanTables(constrained); len(tables) != 0 {
+		t.Errorf("Expected no full scan tables, got %v", tables)
+	}
+	if HasFullScan(nil) {
+		t.Error("Expected no full scan in a nil plan")
+	}
+}
+
+func TestSortAfterFullScan(t *testing.T) {
+	// SELECT * FROM t ORDER BY v
+	node := mustDecode(t, newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(filterOp).
+		op(sortOp).
+		String())
+
+	flagged := SortAfterFullScan(node)
+	if len(flagged) != 1 || flagged[0] != node {
+		t.Errorf("Expected the sort to be flagged, got %v", flagged)
+	}
+}
+
+func TestSortAfterFullScanNegative(t *testing.T) {
+	cases := map[string]string{
+		"constrained scan": newGistBuilder().scan(112, 1, 1, 0, 0).op(sortOp).String(),
+		"limited scan":     newGistBuilder().scan(112, 1, 0, 0, 1).op(sortOp).String(),
+		"intervening limit": newGistBuilder().
+			scan(112, 1, 0, 0, 0).op(limitOp).op(sortOp).String(),
+		"no sort": newGistBuilder().scan(112, 1, 0, 0, 0).op(filterOp).String(),
+	}
+	for name, gist := range cases {
+		if flagged := SortAfterFullScan(mustDecode(t, gist)); len(flagged) != 0 {
+			t.Errorf("%s: expected nothing to be flagged, got %v", name, flagged)
+		}
+	}
+}
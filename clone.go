@@ -0,0 +1,24 @@
+package gistdecoder
+
+// Clone returns a deep copy of the plan rooted at n. The copy shares no args
+// maps or children slices with the original, so either can be modified
+// without affecting the other. Cloning a nil node returns nil.
+func (n *Node) Clone() *Node {
+	if n == nil {
+		return nil
+	}
+	c := &Node{op: n.op}
+	if n.args != nil {
+		c.args = make(map[string]interface{}, len(n.args))
+		for k, v := range n.args {
+			c.args[k] = v
+		}
+	}
+	if n.children != nil {
+		c.children = make([]*Node, len(n.children))
+		for i, child := range n.children {
+			c.children[i] = child.Clone()
+		}
+	}
+	return c
+}
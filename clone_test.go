@@ -0,0 +1,38 @@
+package gistdecoder
+
+import "testing"
+
+func TestCloneIsIndependent(t *testing.T) {
+	original := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+	before := FormatPlan(original)
+
+	clone := original.Clone()
+	if got := FormatPlan(clone); got != before {
+		t.Fatalf("Expected the clone to format like the original, got:\n%s", got)
+	}
+
+	clone.args["table"] = "redacted"
+	clone.children[0].args["columns"] = 99
+	clone.children[0].children = nil
+	clone.children = append(clone.children, &Node{op: valuesOp})
+
+	if got := FormatPlan(original); got != before {
+		t.Errorf("Expected the original to be unchanged, got:\n%s", got)
+	}
+	if len(original.children) != 1 {
+		t.Errorf("Expected the original to keep 1 child, got %d", len(original.children))
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	var n *Node
+	if n.Clone() != nil {
+		t.Error("Expected cloning a nil node to return nil")
+	}
+
+	// Nil children are preserved rather than dereferenced.
+	n = &Node{op: filterOp, children: []*Node{nil}}
+	if c := n.Clone(); len(c.children) != 1 || c.children[0] != nil {
+		t.Errorf("Expected a single nil child, got %v", c.children)
+	}
+}
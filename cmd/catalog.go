@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	gist "github.com/jonstjohn/crdb-plan-gist-decoder"
+)
+
+// catalogSchema documents the catalog file format for the help output.
+const catalogSchema = `{
+    "tables":  { "<table id>": "<table name>", ... },
+    "indexes": { "<table id>": { "<index id>": "<index name>", ... }, ... }
+  }`
+
+// catalog maps CockroachDB internal table and index IDs to names.
+type catalog struct {
+	Tables  map[int64]string           `json:"tables"`
+	Indexes map[int64]map[int64]string `json:"indexes"`
+}
+
+// loadCatalog reads a JSON catalog file.
+func loadCatalog(path string) (*catalog, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading catalog: %w", err)
+	}
+	var c catalog
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("parsing catalog %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// tableLookup resolves table IDs from the catalog. A nil catalog resolves
+// nothing, so numeric IDs are displayed.
+func (c *catalog) tableLookup() gist.TableLookupFunc {
+	return func(id int64) string {
+		if c == nil {
+			return ""
+		}
+		return c.Tables[id]
+	}
+}
+
+// indexLookup resolves index IDs from the catalog. A nil catalog resolves
+// nothing, so numeric IDs are displayed.
+func (c *catalog) indexLookup() gist.IndexLookupFunc {
+	return func(tableID int64, indexID int64) string {
+		if c == nil {
+			return ""
+		}
+		return c.Indexes[tableID][indexID]
+	}
+}
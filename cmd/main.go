@@ -1,41 +1,184 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	gist "github.com/jonstjohn/crdb-plan-gist-decoder"
 )
 
+// maxLineSize bounds the length of a gist read from stdin.
+const maxLineSize = 1 << 20
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <base64-gist-string>\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "\nDecode CockroachDB plan gists into human-readable EXPLAIN format.\n\n")
-		fmt.Fprintf(os.Stderr, "Example:\n")
-		fmt.Fprintf(os.Stderr, "  %s 'AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM'\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Get gists from CockroachDB:\n")
-		fmt.Fprintf(os.Stderr, "  cockroach sql -e \"SELECT metadata->'plan_gist' FROM crdb_internal.statement_statistics LIMIT 1\"\n")
-		os.Exit(1)
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run decodes the gist named by args, or one gist per line of in when no gist
+// argument (or "-") is given, and writes the plans to out. Usage and errors
+// are written to errOut. It returns the process exit code.
+func run(args []string, in io.Reader, out, errOut io.Writer) int {
+	fs := flag.NewFlagSet("crdb-plan-gist-decoder", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	format := fs.String("format", "tree", "output format: tree, json, or dot")
+	catalogPath := fs.String("catalog", "", "JSON `file` mapping table and index IDs to names")
+	color := fs.String("color", "auto", "color tree output: auto (when writing to a terminal), always, or never")
+	ascii := fs.Bool("ascii", false, "draw tree output with ASCII characters only")
+	nodeIDs := fs.Bool("node-ids", false, "prefix each operator in tree output with its node number")
+	hideIDs := fs.Bool("hide-ids", false, "omit table, index, and sequence IDs from json output when the catalog names them")
+	fs.Usage = func() {
+		name := fs.Name()
+		fmt.Fprintf(errOut, "Usage: %s [flags] [<base64-gist-string> | -]\n", name)
+		fmt.Fprintf(errOut, "\nDecode CockroachDB plan gists into human-readable EXPLAIN format.\n")
+		fmt.Fprintf(errOut, "Without a gist argument, or with -, gists are read from stdin, one per line.\n")
+		fmt.Fprintf(errOut, "Gists may be JSON-quoted or wrapped in a statement metadata object.\n\n")
+		fmt.Fprintf(errOut, "Flags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(errOut, "\nExample:\n")
+		fmt.Fprintf(errOut, "  %s 'AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM'\n", name)
+		fmt.Fprintf(errOut, "  %s -format=json 'AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM'\n", name)
+		fmt.Fprintf(errOut, "  cat gists.txt | %s\n", name)
+		fmt.Fprintf(errOut, "  %s -catalog=catalog.json 'AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM'\n\n", name)
+		fmt.Fprintf(errOut, "Catalog file format:\n")
+		fmt.Fprintf(errOut, "  %s\n\n", catalogSchema)
+		fmt.Fprintf(errOut, "Get gists from CockroachDB:\n")
+		fmt.Fprintf(errOut, "  cockroach sql -e \"SELECT metadata->'plan_gist' FROM crdb_internal.statement_statistics LIMIT 1\"\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	switch *format {
+	case "tree", "json", "dot":
+	default:
+		fmt.Fprintf(errOut, "Unknown format %q (expected tree, json, or dot)\n", *format)
+		return 2
 	}
 
-	gistString := os.Args[1]
+	opts := printOptions{format: *format, ascii: *ascii, nodeIDs: *nodeIDs, hideIDs: *hideIDs}
+	switch *color {
+	case "always":
+		opts.color = true
+	case "never":
+	case "auto":
+		opts.color = isTerminal(out)
+	default:
+		fmt.Fprintf(errOut, "Unknown color mode %q (expected auto, always, or never)\n", *color)
+		return 2
+	}
+	var cat *catalog
+	if *catalogPath != "" {
+		var err error
+		if cat, err = loadCatalog(*catalogPath); err != nil {
+			fmt.Fprintf(errOut, "Error loading catalog: %v\n", err)
+			return 1
+		}
+	}
+	// Without a catalog the lookups resolve nothing, so numeric IDs are
+	// displayed.
+	opts.tableLookup = cat.tableLookup()
+	opts.indexLookup = cat.indexLookup()
 
-	// Default lookup functions return empty string (displays numeric IDs)
-	// You can customize these to provide actual table/index names
-	tableLookup := func(id int64) string {
-		return ""
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		if err := printGist(fs.Arg(0), opts, out); err != nil {
+			fmt.Fprintf(errOut, "%v\n", err)
+			return 1
+		}
+		return 0
 	}
 
-	indexLookup := func(tableID int64, indexID int64) string {
-		return ""
+	return runLines(in, opts, out, errOut, fs.Usage)
+}
+
+// printOptions controls how gists are decoded and printed.
+type printOptions struct {
+	format      string
+	color       bool
+	ascii       bool
+	nodeIDs     bool
+	hideIDs     bool
+	tableLookup gist.TableLookupFunc
+	indexLookup gist.IndexLookupFunc
+}
+
+// runLines decodes each non-empty line of in as a gist, printing each plan
+// under a header with its line number. A gist that fails to decode is
+// reported on errOut without stopping the rest. If in holds no gists at all,
+// usage is printed instead.
+func runLines(in io.Reader, opts printOptions, out, errOut io.Writer, usage func()) int {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	code := 0
+	decoded := 0
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if decoded > 0 {
+			fmt.Fprintln(out)
+		}
+		decoded++
+		fmt.Fprintf(out, "-- line %d --\n", lineNum)
+		if err := printGist(line, opts, out); err != nil {
+			fmt.Fprintf(errOut, "line %d: %v\n", lineNum, err)
+			code = 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(errOut, "Error reading input: %v\n", err)
+		return 1
+	}
+	if decoded == 0 {
+		usage()
+		return 1
 	}
+	return code
+}
 
-	node, err := gist.DecodePlanGist(gistString, tableLookup, indexLookup)
+// printGist decodes gistString and writes the plan to out. The gist may also
+// be given as selected from statement_statistics metadata: a JSON-quoted
+// string or the whole metadata object.
+func printGist(gistString string, opts printOptions, out io.Writer) error {
+	node, err := gist.DecodeFromMetadataJSON(gistString, opts.tableLookup, opts.indexLookup)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error decoding gist: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("Error decoding gist: %w", err)
 	}
 
-	output := gist.FormatPlan(node)
-	fmt.Print(output)
+	switch opts.format {
+	case "json":
+		b, err := gist.PlanToJSONWithOptions(node, gist.JSONOptions{HideIDs: opts.hideIDs})
+		if err != nil {
+			return fmt.Errorf("Error encoding plan: %w", err)
+		}
+		fmt.Fprintf(out, "%s\n", b)
+	case "dot":
+		fmt.Fprint(out, gist.FormatPlanDOT(node))
+	default:
+		fmt.Fprint(out, gist.FormatPlanWithOptions(node, gist.FormatOptions{
+			Color:       opts.color,
+			ASCII:       opts.ascii,
+			ShowNodeIDs: opts.nodeIDs,
+		}))
+	}
+	return nil
+}
+
+// isTerminal reports whether w is a terminal, so that -color=auto only
+// colors output that a person is looking at rather than a pipe or file.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
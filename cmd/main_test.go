@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testGist = "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+
+func TestRunDefaultFormat(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if code := run([]string{testGist}, strings.NewReader(""), &out, &errOut); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	if !strings.Contains(out.String(), "• update") {
+		t.Errorf("Expected tree output, got:\n%s", out.String())
+	}
+}
+
+func TestRunFormats(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if code := run([]string{"-format=json", testGist}, strings.NewReader(""), &out, &errOut); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	var plan map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &plan); err != nil {
+		t.Fatalf("Expected JSON output, got %v:\n%s", err, out.String())
+	}
+	if plan["op"] != "update" {
+		t.Errorf("Expected update root, got %v", plan["op"])
+	}
+
+	out.Reset()
+	if code := run([]string{"--format", "dot", testGist}, strings.NewReader(""), &out, &errOut); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	if !strings.HasPrefix(out.String(), "digraph") {
+		t.Errorf("Expected DOT output, got:\n%s", out.String())
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if code := run(nil, strings.NewReader(""), &out, &errOut); code != 1 {
+		t.Errorf("Expected exit code 1 without a gist, got %d", code)
+	}
+	if !strings.Contains(errOut.String(), "Usage:") {
+		t.Errorf("Expected usage text, got:\n%s", errOut.String())
+	}
+
+	errOut.Reset()
+	if code := run([]string{"-format=yaml", testGist}, strings.NewReader(""), &out, &errOut); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown format, got %d", code)
+	}
+
+	errOut.Reset()
+	if code := run([]string{"not-valid-base64!"}, strings.NewReader(""), &out, &errOut); code != 1 {
+		t.Errorf("Expected exit code 1 for an invalid gist, got %d", code)
+	}
+	if !strings.Contains(errOut.String(), "Error decoding gist") {
+		t.Errorf("Expected decode error, got:\n%s", errOut.String())
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	in := strings.NewReader(testGist + "\n\nnot-valid-base64!\n  " + testGist + "  \n")
+
+	var out, errOut bytes.Buffer
+	if code := run(nil, in, &out, &errOut); code != 1 {
+		t.Errorf("Expected exit code 1 when a line fails, got %d", code)
+	}
+
+	output := out.String()
+	for _, expected := range []string{"-- line 1 --\n  • update", "-- line 3 --\n", "\n\n-- line 4 --\n  • update"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "line 2") {
+		t.Errorf("Expected blank line 2 to be skipped, got:\n%s", output)
+	}
+	if strings.Count(output, "• update") != 2 {
+		t.Errorf("Expected both valid gists to be decoded, got:\n%s", output)
+	}
+	if !strings.Contains(errOut.String(), "line 3: Error decoding gist") {
+		t.Errorf("Expected line 3 error on stderr, got:\n%s", errOut.String())
+	}
+}
+
+func TestRunMetadataJSON(t *testing.T) {
+	for _, input := range []string{`"` + testGist + `"`, `{"plan_gist": "` + testGist + `"}`} {
+		var out, errOut bytes.Buffer
+		if code := run([]string{input}, strings.NewReader(""), &out, &errOut); code != 0 {
+			t.Fatalf("Expected exit code 0 for %s, got %d: %s", input, code, errOut.String())
+		}
+		if !strings.Contains(out.String(), "• update") {
+			t.Errorf("Expected tree output for %s, got:\n%s", input, out.String())
+		}
+	}
+}
+
+func TestRunStdinDash(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if code := run([]string{"-format=dot", "-"}, strings.NewReader(testGist+"\n"), &out, &errOut); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	if !strings.Contains(out.String(), "-- line 1 --\ndigraph") {
+		t.Errorf("Expected DOT output for line 1, got:\n%s", out.String())
+	}
+}
+
+func TestRunCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	catalog := `{"tables": {"112": "users"}, "indexes": {"112": {"1": "users_pkey"}}}`
+	if err := os.WriteFile(path, []byte(catalog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	if code := run([]string{"-catalog", path, testGist}, strings.NewReader(""), &out, &errOut); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	for _, expected := range []string{"table: users\n", "table: users@users_pkey"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestRunHideIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	catalog := `{"tables": {"112": "users"}, "indexes": {"112": {"1": "users_pkey"}}}`
+	if err := os.WriteFile(path, []byte(catalog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	if code := run([]string{"-catalog", path, "-format", "json", "-hide-ids", testGist}, strings.NewReader(""), &out, &errOut); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	if strings.Contains(out.String(), "table_id") || strings.Contains(out.String(), "index_id") {
+		t.Errorf("Expected no IDs in the output, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `"table": "users"`) {
+		t.Errorf("Expected the table name in the output, got:\n%s", out.String())
+	}
+}
+
+func TestRunCatalogErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"tables": {"users": 112}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "missing.json"), invalid} {
+		var out, errOut bytes.Buffer
+		if code := run([]string{"-catalog", path, testGist}, strings.NewReader(""), &out, &errOut); code != 1 {
+			t.Errorf("%s: expected exit code 1, got %d", path, code)
+		}
+		if !strings.Contains(errOut.String(), "Error loading catalog") {
+			t.Errorf("%s: expected catalog error, got:\n%s", path, errOut.String())
+		}
+	}
+}
+
+func TestRunColor(t *testing.T) {
+	// A full scan, so both the scan name and its FULL SCAN spans are colored.
+	const fullScanGist = "AgHgAQIAAAAAAA=="
+	var out, errOut bytes.Buffer
+	if code := run([]string{"-color=always", fullScanGist}, strings.NewReader(""), &out, &errOut); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	if !strings.Contains(out.String(), "\x1b[31mFULL SCAN\x1b[0m") {
+		t.Errorf("Expected colored output with -color=always, got %q", out.String())
+	}
+
+	// Neither -color=never nor auto, when out is not a terminal, colors.
+	for _, args := range [][]string{{"-color=never", fullScanGist}, {fullScanGist}} {
+		out.Reset()
+		if code := run(args, strings.NewReader(""), &out, &errOut); code != 0 {
+			t.Fatalf("Expected exit code 0 for %v, got %d: %s", args, code, errOut.String())
+		}
+		if strings.Contains(out.String(), "\x1b[") {
+			t.Errorf("Expected no ANSI codes for %v, got %q", args, out.String())
+		}
+	}
+
+	errOut.Reset()
+	if code := run([]string{"-color=sometimes", fullScanGist}, strings.NewReader(""), &out, &errOut); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown color mode, got %d", code)
+	}
+	if !strings.Contains(errOut.String(), `Unknown color mode "sometimes"`) {
+		t.Errorf("Expected an unknown color mode error, got %q", errOut.String())
+	}
+}
+
+func TestRunNodeIDs(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if code := run([]string{"-node-ids", testGist}, strings.NewReader(""), &out, &errOut); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	if !strings.HasPrefix(out.String(), "  [1] • update\n") {
+		t.Errorf("Expected the root to be numbered 1, got:\n%s", out.String())
+	}
+}
+
+func TestRunASCII(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if code := run([]string{"-ascii", testGist}, strings.NewReader(""), &out, &errOut); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	if !strings.HasPrefix(out.String(), "  * update\n") || strings.Contains(out.String(), "•") {
+		t.Errorf("Expected ASCII tree output, got:\n%s", out.String())
+	}
+}
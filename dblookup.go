@@ -0,0 +1,86 @@
+package gistdecoder
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+const (
+	tableNameQuery = `SELECT name FROM crdb_internal.tables WHERE table_id = $1`
+	indexNameQuery = `SELECT index_name FROM crdb_internal.table_indexes WHERE descriptor_id = $1 AND index_id = $2`
+)
+
+// NewDBLookups returns table and index lookup functions that resolve IDs by
+// querying a live CockroachDB cluster through db. Results are cached for the
+// lifetime of the returned functions, so each ID is queried at most once;
+// IDs that do not exist are cached as unknown too. Query errors other than a
+// missing row are not cached and resolve to the empty string, so the numeric
+// ID is displayed.
+//
+// Tables are resolved from crdb_internal.tables and indexes from
+// crdb_internal.table_indexes. These virtual tables only list objects the
+// connected user has privileges on, so the user needs at least one privilege
+// (such as SELECT) on every table whose name should be resolved.
+//
+// The package does not import a database driver; register one (for example
+// github.com/jackc/pgx/v5/stdlib) and open db as usual.
+func NewDBLookups(db *sql.DB) (TableLookupFunc, IndexLookupFunc, error) {
+	if db == nil {
+		return nil, nil, errors.New("nil database handle")
+	}
+	if err := db.Ping(); err != nil {
+		return nil, nil, err
+	}
+
+	type indexKey struct {
+		tableID int64
+		indexID int64
+	}
+	var mu sync.Mutex
+	tables := make(map[int64]string)
+	indexes := make(map[indexKey]string)
+
+	tableLookup := func(id int64) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if name, ok := tables[id]; ok {
+			return name
+		}
+		name, ok := queryName(db, tableNameQuery, id)
+		if ok {
+			tables[id] = name
+		}
+		return name
+	}
+
+	indexLookup := func(tableID int64, indexID int64) string {
+		mu.Lock()
+		defer mu.Unlock()
+		key := indexKey{tableID, indexID}
+		if name, ok := indexes[key]; ok {
+			return name
+		}
+		name, ok := queryName(db, indexNameQuery, tableID, indexID)
+		if ok {
+			indexes[key] = name
+		}
+		return name
+	}
+
+	return tableLookup, indexLookup, nil
+}
+
+// queryName runs a single-column name query. It reports whether the result
+// is definitive (found, or known not to exist) and may be cached.
+func queryName(db *sql.DB, query string, args ...interface{}) (string, bool) {
+	var name string
+	err := db.QueryRow(query, args...).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", true
+	}
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
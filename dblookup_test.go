@@ -0,0 +1,172 @@
+package gistdecoder
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// mockDriver is a database/sql driver that answers name queries from a
+// canned map keyed by the formatted query arguments, recording every query.
+type mockDriver struct {
+	mu      sync.Mutex
+	queries []string
+	names   map[string]string
+	fail    bool
+}
+
+func (d *mockDriver) Open(name string) (driver.Conn, error) { return &mockConn{d}, nil }
+
+type mockConn struct{ d *mockDriver }
+
+func (c *mockConn) Prepare(query string) (driver.Stmt, error) { return &mockStmt{c.d, query}, nil }
+func (c *mockConn) Close() error                              { return nil }
+func (c *mockConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type mockStmt struct {
+	d     *mockDriver
+	query string
+}
+
+func (s *mockStmt) Close() error  { return nil }
+func (s *mockStmt) NumInput() int { return -1 }
+
+func (s *mockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *mockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.queries = append(s.d.queries, fmt.Sprintf("%s %v", s.query, args))
+	if s.d.fail {
+		return nil, errors.New("connection reset")
+	}
+	rows := &mockRows{}
+	if name, ok := s.d.names[fmt.Sprint(args)]; ok {
+		rows.values = []string{name}
+	}
+	return rows, nil
+}
+
+type mockRows struct{ values []string }
+
+func (r *mockRows) Columns() []string { return []string{"name"} }
+func (r *mockRows) Close() error      { return nil }
+
+func (r *mockRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
+
+var (
+	registerMockOnce sync.Once
+	mock             = &mockDriver{}
+)
+
+func openMockDB(t *testing.T, names map[string]string) *sql.DB {
+	t.Helper()
+	registerMockOnce.Do(func() { sql.Register("gistdecoder-mock", mock) })
+	mock.mu.Lock()
+	mock.queries, mock.names, mock.fail = nil, names, false
+	mock.mu.Unlock()
+
+	db, err := sql.Open("gistdecoder-mock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestNewDBLookups(t *testing.T) {
+	db := openMockDB(t, map[string]string{
+		"[112]":   "users",
+		"[112 1]": "users_pkey",
+	})
+
+	tableLookup, indexLookup, err := NewDBLookups(db)
+	if err != nil {
+		t.Fatalf("Failed to create lookups: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if name := tableLookup(112); name != "users" {
+			t.Errorf("Expected table 112 to be users, got %q", name)
+		}
+		if name := indexLookup(112, 1); name != "users_pkey" {
+			t.Errorf("Expected index 112@1 to be users_pkey, got %q", name)
+		}
+		if name := tableLookup(999); name != "" {
+			t.Errorf("Expected unknown table to resolve to empty, got %q", name)
+		}
+	}
+
+	expected := []string{
+		tableNameQuery + " [112]",
+		indexNameQuery + " [112 1]",
+		tableNameQuery + " [999]",
+	}
+	if !reflect.DeepEqual(mock.queries, expected) {
+		t.Errorf("Expected each ID to be queried once:\n%v\ngot:\n%v", expected, mock.queries)
+	}
+}
+
+func TestNewDBLookupsErrorsNotCached(t *testing.T) {
+	db := openMockDB(t, map[string]string{"[112]": "users"})
+
+	tableLookup, _, err := NewDBLookups(db)
+	if err != nil {
+		t.Fatalf("Failed to create lookups: %v", err)
+	}
+
+	mock.mu.Lock()
+	mock.fail = true
+	mock.mu.Unlock()
+	if name := tableLookup(112); name != "" {
+		t.Errorf("Expected failed query to resolve to empty, got %q", name)
+	}
+
+	mock.mu.Lock()
+	mock.fail = false
+	mock.mu.Unlock()
+	if name := tableLookup(112); name != "users" {
+		t.Errorf("Expected retry after failure to resolve users, got %q", name)
+	}
+}
+
+func TestNewDBLookupsWithDecode(t *testing.T) {
+	db := openMockDB(t, map[string]string{
+		"[112]":   "users",
+		"[112 1]": "users_pkey",
+	})
+
+	tableLookup, indexLookup, err := NewDBLookups(db)
+	if err != nil {
+		t.Fatalf("Failed to create lookups: %v", err)
+	}
+
+	node, err := DecodePlanGist("AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM", tableLookup, indexLookup)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	scan := node.children[0].children[0].children[0]
+	if scan.args["table"] != "users" || scan.args["index"] != "users_pkey" {
+		t.Errorf("Expected users@users_pkey, got %v@%v", scan.args["table"], scan.args["index"])
+	}
+}
+
+func TestNewDBLookupsNilDB(t *testing.T) {
+	if _, _, err := NewDBLookups(nil); err == nil {
+		t.Error("Expected error for nil database")
+	}
+}
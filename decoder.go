@@ -8,13 +8,83 @@ package gistdecoder
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
+// gistVersion is the latest gist encoding version the decoder knows the
+// layout of. CockroachDB has only emitted version 1 so far; later versions
+// accepted through WithMaxVersion are decoded with this layout, which holds
+// as long as the changes are additive (new operators or trailing fields).
 const gistVersion = 1
 
+// maxPooledBufferSize bounds the gist buffers a pooled decoder may
+// keep, so one unusually large gist doesn't pin its memory in the pool.
+const maxPooledBufferSize = 64 << 10
+
+// ErrMaxNodesExceeded is returned when a gist encodes more operators than the
+// configured maximum (see WithMaxNodes).
+var ErrMaxNodesExceeded = errors.New("plan exceeds max nodes")
+
+// ErrUnsupportedVersion is returned when a gist's version header falls
+// outside the accepted range (see WithMinVersion and WithMaxVersion).
+var ErrUnsupportedVersion = errors.New("unsupported gist version")
+
+// ErrUnknownOperator is returned when a gist contains an operator whose body
+// layout the decoder doesn't know.
+var ErrUnknownOperator = errors.New("cannot decode operator")
+
+// DecodeError is returned when the binary gist data can't be read, such as
+// when a gist is truncated partway through an operator. Offset is the byte
+// offset into the decoded gist at which the failing read started, and Op is
+// the operator whose body was being decoded (unknownOp while reading the
+// version header).
+type DecodeError struct {
+	Offset int
+	Op     execOperator
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Op == unknownOp {
+		return fmt.Sprintf("decode error at byte offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("decode error at byte offset %d in %s: %v", e.Offset, opName(e.Op), e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ErrStackUnderflow is returned when an operator expects an input but no
+// decoded node is available, which indicates a corrupt gist or an operator
+// the decoder does not decode correctly.
+var ErrStackUnderflow = errors.New("node stack underflow")
+
+// ErrStackImbalance is returned when a gist ends with more than one decoded
+// subtree that no operator consumed, so the plan has no single root, or with
+// constraint checks but no main plan. Like
+// ErrStackUnderflow, it indicates a corrupt gist or an operator the decoder
+// does not decode correctly.
+var ErrStackImbalance = errors.New("node stack imbalance")
+
+// maxIntSetSize bounds the number of members decoded from a single intset.
+// Sets hold column ordinals, so real sets are far smaller; the limit stops a
+// crafted range from expanding into a huge allocation.
+const maxIntSetSize = 1 << 16
+
+// ctxCheckInterval is how many operators are decoded between checks for
+// context cancellation.
+const ctxCheckInterval = 64
+
 // TableLookupFunc resolves CockroachDB internal table IDs to table names.
 // Return an empty string to display the numeric ID for unknown tables.
 type TableLookupFunc func(id int64) string
@@ -35,23 +105,43 @@ type Node struct {
 // planGistDecoder handles the binary decoding of plan gist data.
 type planGistDecoder struct {
 	buf           bytes.Reader
+	src           []byte
+	raw           []byte
 	nodeStack     []*Node
+	unsupported   []byte
+	version       int
+	op            execOperator
+	ctx           context.Context
+	config        decodeConfig
 	TableLookupFn TableLookupFunc
 	IndexLookupFn IndexLookupFunc
 }
 
+// offset returns the byte offset of the next read into the decoded gist.
+func (d *planGistDecoder) offset() int {
+	return int(d.buf.Size()) - d.buf.Len()
+}
+
+// fail aborts decoding with a DecodeError for a read that started at offset.
+// The panic is recovered in decodePlan, which returns the error.
+func (d *planGistDecoder) fail(offset int, err error) {
+	panic(&DecodeError{Offset: offset, Op: d.op, Err: err})
+}
+
 func (d *planGistDecoder) decodeInt() int {
+	off := d.offset()
 	val, err := binary.ReadVarint(&d.buf)
 	if err != nil {
-		panic(fmt.Sprintf("decode error: %v", err))
+		d.fail(off, err)
 	}
 	return int(val)
 }
 
 func (d *planGistDecoder) decodeByte() byte {
+	off := d.offset()
 	val, err := d.buf.ReadByte()
 	if err != nil {
-		panic(fmt.Sprintf("decode error: %v", err))
+		d.fail(off, err)
 	}
 	return val
 }
@@ -87,68 +177,116 @@ func (d *planGistDecoder) decodeIndex(tableID int64) (int64, string) {
 }
 
 func (d *planGistDecoder) decodeUvarint() uint64 {
+	off := d.offset()
 	val, err := binary.ReadUvarint(&d.buf)
 	if err != nil {
-		panic(fmt.Sprintf("decode error: %v", err))
+		d.fail(off, err)
 	}
 	return val
 }
 
-// decodeIntSet decodes CockroachDB's intsets.Fast encoding.
+// decodeIntSet decodes CockroachDB's intsets.Fast encoding and returns the
+// members of the set in increasing order.
 // Format: length (uvarint), then either:
-//   - if length == 0: 64-bit bitmap (uvarint)
-//   - if length > 0: length pairs of (start, end) uvarints
-func (d *planGistDecoder) decodeIntSet() {
+//   - if length == 0: 64-bit bitmap (uvarint), for sets whose members are
+//     all below 64
+//   - if length > 0: length members (uvarints), in increasing order
+func (d *planGistDecoder) decodeIntSet() []int {
+	off := d.offset()
 	length := d.decodeUvarint()
 	if length == 0 {
 		// Special case: 64-bit bitmap encoded directly
-		d.decodeUvarint()
-	} else {
-		// Read length number of (start, end) pairs
-		for i := uint64(0); i < length; i++ {
-			d.decodeUvarint() // start
-			d.decodeUvarint() // end
+		bitmap := d.decodeUvarint()
+		var members []int
+		for bitmap != 0 {
+			i := bits.TrailingZeros64(bitmap)
+			members = append(members, i)
+			bitmap &^= 1 << uint(i)
 		}
+		return members
 	}
+	if length > maxIntSetSize {
+		d.fail(off, fmt.Errorf("intset has %d members, more than %d", length, maxIntSetSize))
+	}
+	members := make([]int, 0, length)
+	for i := uint64(0); i < length; i++ {
+		members = append(members, int(d.decodeUvarint()))
+	}
+	return members
 }
 
+// decodeScanParams decodes the scan parameters that follow a scan's table and
+// index. The layout is:
+//   - needed columns (intset)
+//   - index constraint flag (int, 1 or 0)
+//   - inverted constraint flag (int, 1 or 0)
+//   - hard limit flag (int, 1 or 0)
+//
+// Nothing else is encoded: in particular the column families a scan reads are
+// not part of the gist, so they cannot be recovered from it. Neither is the
+// row-level locking of SELECT ... FOR UPDATE: its strength and wait policy
+// have no bytes in the gist, so a locking scan decodes the same as any other.
 func (d *planGistDecoder) decodeScanParams() map[string]interface{} {
 	// Decode needed columns (intset)
-	d.decodeIntSet()
+	neededCols := len(d.decodeIntSet())
 
-	// Decode index constraint (number of spans)
-	numSpans := d.decodeInt()
+	// Decode index constraint
+	indexConstraint := d.decodeInt()
 
 	// Decode inverted constraint
-	numInvertedSpans := d.decodeInt()
+	invertedConstraint := d.decodeInt()
 
 	// Decode hard limit
 	hardLimit := d.decodeInt()
 
 	params := make(map[string]interface{})
-	if numSpans > 0 {
-		if numSpans == 1 {
-			params["spans"] = "1 span"
-		} else {
-			params["spans"] = fmt.Sprintf("%d spans", numSpans)
-		}
+	// The number of table columns the scan fetches.
+	params["needed_cols"] = neededCols
+	// A scan is only a full scan if neither a regular nor an inverted
+	// constraint restricts it; a hard limit alone does not constrain the spans.
+	params["full_scan"] = indexConstraint == 0 && invertedConstraint == 0
+	if indexConstraint != 0 {
+		// The gist holds only whether the scan is constrained, not its spans
+		// or how many there are, so FormatPlan shows it as "1+ spans", as
+		// CockroachDB does for a decoded gist.
+		params["index_constraint"] = true
 	}
-	if numInvertedSpans > 0 {
+	if invertedConstraint != 0 {
 		params["inverted_constraint"] = true
 	}
 	if hardLimit != 0 {
-		params["limit"] = "limited"
+		// Only whether the scan has a hard limit, such as a LIMIT pushed into
+		// the scan, is encoded; the limit itself is not.
+		params["hard_limit"] = true
 	}
 
 	return params
 }
 
-func (d *planGistDecoder) decodeNodeColumnOrdinals() []int {
+// decodeNodeColumnOrdinals decodes a list of input column ordinals, returning
+// the number of ordinals. Only the length is encoded; the ordinals themselves
+// are not part of the gist, so there are no further bytes to consume. The
+// real gist AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM shows this: its simple project
+// (05) has 10 columns (14) and is followed directly by the update operator
+// (21).
+func (d *planGistDecoder) decodeNodeColumnOrdinals() int {
 	l := d.decodeInt()
 	if l < 0 {
-		return nil
+		return 0
 	}
-	return make([]int, l)
+	return l
+}
+
+// decodeColumnOrdering decodes a column ordering, returning the number of
+// ordering columns. Only the length is encoded; the columns and their
+// directions are not part of the gist. This layout, which merge joins and
+// group bys share, is unverified: no gist captured from CockroachDB pins it.
+func (d *planGistDecoder) decodeColumnOrdering() int {
+	l := d.decodeInt()
+	if l < 0 {
+		return 0
+	}
+	return l
 }
 
 func (d *planGistDecoder) decodeResultColumns() int {
@@ -171,10 +309,12 @@ func (d *planGistDecoder) decodeRows() int {
 	return d.decodeInt()
 }
 
+// popChild pops the input of the operator being decoded off the node stack.
+// It panics with ErrStackUnderflow if the stack is empty.
 func (d *planGistDecoder) popChild() *Node {
 	l := len(d.nodeStack)
 	if l == 0 {
-		return nil
+		panic(fmt.Errorf("%w: %s expects an input but none was decoded", ErrStackUnderflow, opName(d.op)))
 	}
 	n := d.nodeStack[l-1]
 	d.nodeStack = d.nodeStack[:l-1]
@@ -210,10 +350,12 @@ func (d *planGistDecoder) decodeOperatorBody(op execOperator) (*Node, error) {
 		n.children = append(n.children, d.popChild())
 
 	case invertedFilterOp:
+		// The inverted column, span expression and pre-filter are not
+		// encoded.
 		n.children = append(n.children, d.popChild())
 
 	case simpleProjectOp, serializingProjectOp:
-		_ = d.decodeNodeColumnOrdinals() // cols
+		n.args["columns"] = d.decodeNodeColumnOrdinals()
 		n.children = append(n.children, d.popChild())
 
 	case renderOp:
@@ -228,8 +370,8 @@ func (d *planGistDecoder) decodeOperatorBody(op execOperator) (*Node, error) {
 		leftKey := d.decodeBool()
 		rightKey := d.decodeBool()
 		n.args["type"] = joinType
-		n.args["left_eq_cols"] = len(leftEqCols)
-		n.args["right_eq_cols"] = len(rightEqCols)
+		n.args["left_eq_cols"] = leftEqCols
+		n.args["right_eq_cols"] = rightEqCols
 		if leftKey {
 			n.args["left_key"] = true
 		}
@@ -240,80 +382,145 @@ func (d *planGistDecoder) decodeOperatorBody(op execOperator) (*Node, error) {
 		left := d.popChild()
 		n.children = append(n.children, left, right)
 
+	case applyJoinOp:
+		// An apply join runs its right side once per left row, re-planning
+		// it with the row's values bound in, which is what makes it
+		// correlated. The right side is planned at execution time, so only
+		// the join type and the left input are in the gist.
+		n.args["type"] = d.decodeJoinType()
+		n.args["correlated"] = true
+		n.children = append(n.children, d.popChild())
+
 	case mergeJoinOp:
 		joinType := d.decodeJoinType()
-		_ = d.decodeBool() // leftKey
-		_ = d.decodeBool() // rightKey
+		// The input orderings are the equality columns, in matching order.
+		// Like the group by ordering, their layout is unverified.
+		leftOrdering := d.decodeColumnOrdering()
+		rightOrdering := d.decodeColumnOrdering()
+		leftKey := d.decodeBool()
+		rightKey := d.decodeBool()
 		n.args["type"] = joinType
+		n.args["left_eq_cols"] = leftOrdering
+		n.args["right_eq_cols"] = rightOrdering
+		if leftKey {
+			n.args["left_key"] = true
+		}
+		if rightKey {
+			n.args["right_key"] = true
+		}
 		right := d.popChild()
 		left := d.popChild()
 		n.children = append(n.children, left, right)
 
 	case groupByOp:
-		_ = d.decodeNodeColumnOrdinals() // groupCols
+		n.args["group_cols"] = d.decodeNodeColumnOrdinals()
+		// A non-empty grouping column ordering means the input arrives sorted
+		// on the grouping columns, so the group by can stream. Like the merge
+		// join orderings, its layout is unverified.
+		n.args["ordered"] = d.decodeColumnOrdering() > 0
 		n.children = append(n.children, d.popChild())
 
 	case scalarGroupByOp:
 		n.children = append(n.children, d.popChild())
 
 	case distinctOp:
+		// Neither the distinct columns nor the input ordering is encoded, and
+		// neither is whether the distinct errors on duplicates, as the checks
+		// of a unique index build do.
 		n.children = append(n.children, d.popChild())
 
 	case sortOp:
+		// The sort ordering is not encoded.
 		n.children = append(n.children, d.popChild())
 
 	case limitOp:
+		// The limit and offset expressions are not encoded.
 		n.children = append(n.children, d.popChild())
 
 	case topKOp:
+		// Only k is encoded; the ordering is not part of the gist.
 		k := d.decodeInt()
 		n.args["k"] = k
 		n.children = append(n.children, d.popChild())
 
 	case indexJoinOp:
+		// The key columns join the input's rows back to the table's primary
+		// index. Like other column ordinals, only their count is encoded.
 		tableID, tableName := d.decodeTable()
-		_ = d.decodeNodeColumnOrdinals() // keyCols
+		keyCols := d.decodeNodeColumnOrdinals()
 		n.args["table"] = tableName
 		n.args["table_id"] = tableID
+		n.args["key_cols"] = keyCols
 		n.children = append(n.children, d.popChild())
 
 	case lookupJoinOp:
+		// Whether a multi-region lookup join reads from remote regions is not
+		// encoded: the lookup expressions have no bytes, so a remote lookup
+		// decodes the same as a local one.
 		joinType := d.decodeJoinType()
 		tableID, tableName := d.decodeTable()
-		_, indexName := d.decodeIndex(tableID)
-		_ = d.decodeNodeColumnOrdinals() // eqCols
-		_ = d.decodeBool()                // eqColsAreKey
+		indexID, indexName := d.decodeIndex(tableID)
+		eqCols := d.decodeNodeColumnOrdinals()
+		eqColsAreKey := d.decodeBool()
 		n.args["type"] = joinType
 		n.args["table"] = tableName
 		n.args["index"] = indexName
+		n.args["table_id"] = tableID
+		n.args["index_id"] = indexID
+		n.args["equality_cols"] = eqCols
+		if eqColsAreKey {
+			n.args["eq_cols_are_key"] = true
+		}
 		n.children = append(n.children, d.popChild())
 
 	case invertedJoinOp:
 		joinType := d.decodeJoinType()
 		tableID, tableName := d.decodeTable()
-		_, indexName := d.decodeIndex(tableID)
+		indexID, indexName := d.decodeIndex(tableID)
 		_ = d.decodeNodeColumnOrdinals() // prefixEqCols
 		n.args["type"] = joinType
 		n.args["table"] = tableName
 		n.args["index"] = indexName
+		n.args["table_id"] = tableID
+		n.args["index_id"] = indexID
 		n.children = append(n.children, d.popChild())
 
-	case unionAllOp, hashSetOpOp, streamingSetOpOp:
+	case hashSetOpOp, streamingSetOpOp:
+		// Whether the operation is a union, intersect or except, and whether
+		// it is ALL, is not encoded; only the strategy follows from the
+		// operator.
+		n.args["strategy"] = "hash"
+		if op == streamingSetOpOp {
+			n.args["strategy"] = "streaming"
+		}
+		right := d.popChild()
+		left := d.popChild()
+		n.children = append(n.children, left, right)
+
+	case unionAllOp:
 		right := d.popChild()
 		left := d.popChild()
 		n.children = append(n.children, left, right)
 
 	case insertOp:
 		tableID, tableName := d.decodeTable()
-		d.decodeIntSet() // InsertCols
-		d.decodeIntSet() // ReturnCols
-		d.decodeIntSet() // CheckCols
-		d.decodeBool()   // AutoCommit
+		insertCols := len(d.decodeIntSet())
+		returnCols := len(d.decodeIntSet())
+		checkCols := len(d.decodeIntSet())
+		autoCommit := d.decodeBool()
 		n.args["table"] = tableName
 		n.args["table_id"] = tableID
+		n.args["insert_cols"] = insertCols
+		n.args["return_cols"] = returnCols
+		n.args["has_returning"] = returnCols > 0
+		n.args["auto_commit"] = autoCommit
+		n.args["check_cols"] = checkCols
 		n.children = append(n.children, d.popChild())
 
 	case updateOp:
+		// Only the table is decoded. In the real gist
+		// AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM more bytes follow the table, whose
+		// layout isn't known; the first is 0, which ends the operator stream.
 		tableID, tableName := d.decodeTable()
 		n.args["table"] = tableName
 		n.args["table_id"] = tableID
@@ -321,33 +528,179 @@ func (d *planGistDecoder) decodeOperatorBody(op execOperator) (*Node, error) {
 
 	case deleteOp:
 		tableID, tableName := d.decodeTable()
-		d.decodeIntSet() // FetchCols
-		d.decodeIntSet() // ReturnCols
-		d.decodeBool()   // AutoCommit
+		fetchCols := len(d.decodeIntSet())
+		returnCols := len(d.decodeIntSet())
+		autoCommit := d.decodeBool()
 		n.args["table"] = tableName
 		n.args["table_id"] = tableID
+		n.args["fetch_cols"] = fetchCols
+		n.args["return_cols"] = returnCols
+		n.args["has_returning"] = returnCols > 0
+		n.args["auto_commit"] = autoCommit
 		n.children = append(n.children, d.popChild())
 
 	case upsertOp:
+		// The arbiter indexes and constraints that detect conflicts are not
+		// encoded, only the column sets the upsert reads and writes.
+		tableID, tableName := d.decodeTable()
+		insertCols := len(d.decodeIntSet())
+		fetchCols := len(d.decodeIntSet())
+		updateCols := len(d.decodeIntSet())
+		returnCols := len(d.decodeIntSet())
+		checkCols := len(d.decodeIntSet())
+		autoCommit := d.decodeBool()
+		n.args["table"] = tableName
+		n.args["table_id"] = tableID
+		n.args["insert_cols"] = insertCols
+		n.args["fetch_cols"] = fetchCols
+		n.args["update_cols"] = updateCols
+		n.args["return_cols"] = returnCols
+		n.args["has_returning"] = returnCols > 0
+		n.args["auto_commit"] = autoCommit
+		n.args["check_cols"] = checkCols
+		n.children = append(n.children, d.popChild())
+
+	case createTableOp:
+		// Only the descriptor ID of the schema the table is created in is
+		// encoded; the new table has no ID or name in the gist.
+		n.args["schema_id"] = d.decodeID()
+
+	case createTableAsOp:
+		n.args["schema_id"] = d.decodeID()
+		n.children = append(n.children, d.popChild())
+
+	case createFunctionOp:
+		// Like create table, only the schema the routine is created in is
+		// encoded; the routine's own name is not.
+		n.args["schema_id"] = d.decodeID()
+
+	case createViewOp:
+		// The view's query is stored as SQL text rather than planned, so it
+		// is not a child; only the schema and the number of view columns
+		// are encoded.
+		n.args["schema_id"] = d.decodeID()
+		n.args["columns"] = d.decodeResultColumns()
+
+	case createTriggerOp:
+		// The trigger's table and function are named in the statement,
+		// which gists don't encode, so nothing follows the operator byte.
+
+	case alterTableSplitOp, alterTableUnsplitOp, alterTableRelocateOp:
+		// The input produces the split points or relocation targets.
 		tableID, tableName := d.decodeTable()
-		d.decodeIntSet() // InsertCols
-		d.decodeIntSet() // FetchCols
-		d.decodeIntSet() // UpdateCols
-		d.decodeIntSet() // ReturnCols
-		d.decodeIntSet() // Checks
-		d.decodeBool()   // AutoCommit
+		indexID, indexName := d.decodeIndex(tableID)
 		n.args["table"] = tableName
+		n.args["index"] = indexName
 		n.args["table_id"] = tableID
+		n.args["index_id"] = indexID
+		n.children = append(n.children, d.popChild())
+
+	case alterTableUnsplitAllOp:
+		tableID, tableName := d.decodeTable()
+		indexID, indexName := d.decodeIndex(tableID)
+		n.args["table"] = tableName
+		n.args["index"] = indexName
+		n.args["table_id"] = tableID
+		n.args["index_id"] = indexID
+
+	case sequenceSelectOp:
+		// Sequences are descriptors like tables, so the table lookup
+		// resolves their names.
+		seqID, seqName := d.decodeTable()
+		n.args["sequence"] = seqName
+		n.args["sequence_id"] = seqID
+
+	case explainOp, explainOptOp:
+		// The explained plan is built by a separate factory passed to the
+		// explain operator, so its operators never reach the gist; an
+		// EXPLAIN gist is the explain operator alone. EXPLAIN (OPT) only
+		// carries the optimizer's text output. The EXPLAIN options, such as
+		// OPT or VERBOSE, are a struct the gist factory doesn't encode, so
+		// every flavor of EXPLAIN produces the same gist.
+
+	case saveTableOp:
+		// The destination table doesn't exist yet and is referenced by name,
+		// which gists don't encode; only the input being saved remains.
+		n.children = append(n.children, d.popChild())
+
+	case controlJobsOp, controlSchedulesOp:
+		// The input produces the job or schedule IDs. The command (PAUSE,
+		// RESUME, CANCEL, ...) is not encoded, so only the operator tells
+		// which kind of object is controlled.
+		n.children = append(n.children, d.popChild())
+
+	case cancelQueriesOp, cancelSessionsOp:
+		// The input produces the query or session IDs to cancel.
+		if d.decodeBool() {
+			n.args["if_exists"] = true
+		}
+		n.children = append(n.children, d.popChild())
+
+	case callOp:
+		// CALL encodes neither the procedure nor its arguments; argument
+		// expressions are evaluated inside the routine, so there is no input
+		// to pop either.
+
+	case showTraceOp:
+		// SHOW TRACE FOR SESSION reads the session's recorded trace, so it
+		// has no input. The trace type is a string, which gists don't
+		// encode; only the COMPACT flag follows.
+		if d.decodeBool() {
+			n.args["compact"] = true
+		}
+
+	case showCompletionsOp:
+		// SHOW COMPLETIONS encodes nothing: its statement text is a string.
+
+	case opaqueOp:
+		// Opaque operators carry only planner metadata, none of which is
+		// encoded, and have no input.
+
+	case exportOp:
+		// The destination and file format are strings, which gists don't
+		// encode; only the set of columns declared NOT NULL follows.
+		n.args["not_null_cols"] = len(d.decodeIntSet())
 		n.children = append(n.children, d.popChild())
 
 	case errorIfRowsOp:
 		n.children = append(n.children, d.popChild())
 
+	case windowOp:
+		// The window function definitions, including their frames and frame
+		// exclusion (EXCLUDE CURRENT ROW / GROUP / TIES), are not encoded in
+		// the gist, so the operator has no body to decode.
+		n.children = append(n.children, d.popChild())
+
+	case bufferOp:
+		n.args["buffer_id"] = d.decodeInt()
+		n.children = append(n.children, d.popChild())
+
+	case recursiveCTEOp:
+		// Only the initial (base) input is a child: the recursive input is
+		// planned anew on each iteration and so isn't part of the gist, and
+		// the label is a string. What follows is whether the CTE is UNION
+		// rather than UNION ALL, deduplicating the rows it produces.
+		n.args["deduplicate"] = d.decodeBool()
+		n.children = append(n.children, d.popChild())
+
+	case scanBufferOp:
+		// A scan buffer reads the rows saved by the buffer with the same
+		// label; it has no input of its own.
+		n.args["buffer_id"] = d.decodeInt()
+
+	case ordinalityOp, max1RowOp:
+		// Only the input is encoded; the ordinality column name and the
+		// max1Row error text are not part of the gist.
+		n.children = append(n.children, d.popChild())
+
 	default:
-		// For unknown operators, try to pop a child if one exists
-		if len(d.nodeStack) > 0 {
-			n.children = append(n.children, d.popChild())
-		}
+		// The gist has no length prefix on operator bodies, so the body of an
+		// operator the decoder doesn't know can't be skipped. Guessing would
+		// desync the rest of the stream, so stop here instead.
+		offset := d.offset() - 1
+		d.unsupported = append(d.unsupported, byte(op))
+		return nil, fmt.Errorf("%w %s (code %d) at byte offset %d",
+			ErrUnknownOperator, opName(op), byte(op), offset)
 	}
 
 	return n, nil
@@ -359,7 +712,8 @@ func (d *planGistDecoder) decodeOp() execOperator {
 		return unknownOp
 	}
 
-	n, err := d.decodeOperatorBody(execOperator(val))
+	d.op = execOperator(val)
+	n, err := d.decodeOperatorBody(d.op)
 	if err != nil {
 		panic(err)
 	}
@@ -368,48 +722,70 @@ func (d *planGistDecoder) decodeOp() execOperator {
 	return n.op
 }
 
-// DecodePlanGist decodes a base64-encoded CockroachDB plan gist into a plan tree.
-//
-// The tableLookup and indexLookup functions are optional. If nil or if they return
-// an empty string, table and index IDs will be shown as numbers (e.g., "112@1").
-// These functions should map CockroachDB internal IDs to human-readable names.
-//
-// Example:
-//
-//	node, err := DecodePlanGist(gist, tableLookup, indexLookup)
-//	if err != nil {
-//	    return err
-//	}
-//	output := FormatPlan(node)
-//	fmt.Print(output)
-func DecodePlanGist(gist string, tableLookup TableLookupFunc, indexLookup IndexLookupFunc) (*Node, error) {
-	b, err := base64.StdEncoding.DecodeString(gist)
-	if err != nil {
-		return nil, fmt.Errorf("base64 decode error: %w", err)
-	}
-
-	var d planGistDecoder
-	d.buf.Reset(b)
-	d.TableLookupFn = tableLookup
-	d.IndexLookupFn = indexLookup
+// decodePlan decodes the version header and operator stream, returning the
+// root of the plan tree. Decode failures inside operator bodies surface as
+// panics; they are recovered here and returned as an error alongside the
+// most recently completed subtree, if any. Any other panic, such as a nil
+// dereference in the decoder or a lookup function, is a bug rather than a
+// corrupt gist, so it is re-panicked.
+func (d *planGistDecoder) decodePlan() (root *Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			decodeErr, ok := r.(error)
+			if !ok || !isDecodeFailure(decodeErr) {
+				panic(r)
+			}
+			err = decodeErr
+			root = d.partialRoot()
+		}
+	}()
 
 	ver := d.decodeInt()
-	if ver != gistVersion {
-		return nil, fmt.Errorf("unsupported gist version %d (expected %d)", ver, gistVersion)
+	if ver < 1 || ver < d.config.minVersion || ver > d.config.maxVersion {
+		return nil, fmt.Errorf("%w %d (accepted versions %d to %d)",
+			ErrUnsupportedVersion, ver, d.config.minVersion, d.config.maxVersion)
 	}
+	d.version = ver
 
 	var checks []*Node
-	for {
+	for i := 0; ; i++ {
+		if d.ctx != nil && i%ctxCheckInterval == 0 {
+			if err := d.ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
 		op := d.decodeOp()
 		if op == unknownOp {
 			break
 		}
+		if d.config.maxNodes > 0 && i >= d.config.maxNodes {
+			return nil, fmt.Errorf("%w (%d)", ErrMaxNodesExceeded, d.config.maxNodes)
+		}
 		if op == errorIfRowsOp {
 			checks = append(checks, d.popChild())
 		}
 	}
 
-	root := d.popChild()
+	// Nothing is read past the terminating zero. Gists carry no row count or
+	// cost estimates, in a trailing section or per operator: the gist factory
+	// only records operator arguments, so estimates can't be shown.
+
+	// Every subtree but the root must have been consumed as an input;
+	// leftovers mean an operator popped fewer inputs than it was given.
+	if l := len(d.nodeStack); l > 1 {
+		return d.partialRoot(), fmt.Errorf("%w: gist ends with %d subtrees instead of 1", ErrStackImbalance, l)
+	}
+	// The checks are popped as they are decoded, so they must leave the main
+	// plan behind.
+	if len(d.nodeStack) == 0 && len(checks) > 0 {
+		return nil, fmt.Errorf("%w: gist has %d checks but no main plan", ErrStackImbalance, len(checks))
+	}
+
+	// A gist without operators decodes to an empty plan.
+	root = d.partialRoot()
+	if root != nil {
+		d.nodeStack = d.nodeStack[:len(d.nodeStack)-1]
+	}
 
 	// Attach checks if any
 	if len(checks) > 0 {
@@ -423,3 +799,345 @@ func DecodePlanGist(gist string, tableLookup TableLookupFunc, indexLookup IndexL
 
 	return root, nil
 }
+
+// isDecodeFailure reports whether err is one of the failures the decoder
+// raises for a gist it can't decode.
+func isDecodeFailure(err error) bool {
+	var decodeErr *DecodeError
+	return errors.As(err, &decodeErr) || errors.Is(err, ErrStackUnderflow) || errors.Is(err, ErrUnknownOperator)
+}
+
+// isChecksWrapper reports whether n is the synthetic node decodePlan places
+// above a plan with constraint checks; its children are the plan followed by
+// one error if rows subtree per check.
+func isChecksWrapper(n *Node) bool {
+	if n == nil || n.op != unknownOp {
+		return false
+	}
+	_, ok := n.args["checks"]
+	return ok
+}
+
+// Unwrap separates a plan with constraint checks into the main plan and the
+// check subtrees. When n is the synthetic root that decoding places above
+// such a plan, Unwrap returns its first child and the error if rows subtree
+// of each check; for any other node it returns n and nil.
+func (n *Node) Unwrap() (*Node, []*Node) {
+	if !isChecksWrapper(n) || len(n.children) == 0 {
+		return n, nil
+	}
+	checks := make([]*Node, len(n.children)-1)
+	copy(checks, n.children[1:])
+	return n.children[0], checks
+}
+
+// partialRoot returns the most recently completed subtree without removing it
+// from the node stack, or nil if nothing has been decoded yet.
+func (d *planGistDecoder) partialRoot() *Node {
+	if l := len(d.nodeStack); l > 0 {
+		return d.nodeStack[l-1]
+	}
+	return nil
+}
+
+// reset prepares the decoder to decode gist, reusing the buffers left over
+// from previous gists.
+func (d *planGistDecoder) reset(gist string) error {
+	l := base64.StdEncoding.DecodedLen(len(gist))
+	if cap(d.raw) < l {
+		d.raw = make([]byte, l)
+	}
+	d.src = append(d.src[:0], gist...)
+	l, err := base64.StdEncoding.Decode(d.raw[:l], d.src)
+	if err != nil {
+		return fmt.Errorf("base64 decode error: %w", err)
+	}
+	d.raw = d.raw[:l]
+	d.resetBuffer()
+	return nil
+}
+
+// resetFrom prepares the decoder to decode the binary gist read from r,
+// reusing the buffer left over from previous gists.
+func (d *planGistDecoder) resetFrom(r io.Reader) error {
+	buf := bytes.NewBuffer(d.raw[:0])
+	_, err := buf.ReadFrom(r)
+	d.raw = buf.Bytes()
+	if err != nil {
+		return err
+	}
+	d.resetBuffer()
+	return nil
+}
+
+// resetBuffer points the decoder at the binary gist in d.raw and clears the
+// state left over from the previous gist.
+func (d *planGistDecoder) resetBuffer() {
+	d.buf.Reset(d.raw)
+	d.op = unknownOp
+	d.unsupported = d.unsupported[:0]
+	d.version = 0
+	clear(d.nodeStack)
+	d.nodeStack = d.nodeStack[:0]
+}
+
+// decodeGist base64-decodes gist and decodes the resulting plan.
+func (d *planGistDecoder) decodeGist(gist string) (*Node, error) {
+	if err := d.reset(gist); err != nil {
+		return nil, err
+	}
+	return d.decodePlan()
+}
+
+// decoderPool holds idle decoders so that repeated decoding reuses their
+// base64 and node stack buffers instead of allocating new ones.
+var decoderPool = sync.Pool{
+	New: func() interface{} {
+		return new(planGistDecoder)
+	},
+}
+
+// getDecoder returns a pooled decoder configured with the given lookups and
+// options.
+func getDecoder(tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts []DecodeOption) *planGistDecoder {
+	d := decoderPool.Get().(*planGistDecoder)
+	d.TableLookupFn = tableLookup
+	d.IndexLookupFn = indexLookup
+	d.config = defaultDecodeConfig()
+	for _, opt := range opts {
+		opt(&d.config)
+	}
+	return d
+}
+
+// release drops the decoder's references to decoded nodes and lookups and
+// returns it to the pool.
+func (d *planGistDecoder) release() {
+	clear(d.nodeStack)
+	d.nodeStack = d.nodeStack[:0]
+	d.ctx = nil
+	d.TableLookupFn = nil
+	d.IndexLookupFn = nil
+	d.buf.Reset(nil)
+	if cap(d.src) > maxPooledBufferSize || cap(d.raw) > maxPooledBufferSize {
+		return
+	}
+	decoderPool.Put(d)
+}
+
+// decodePlanGist decodes gist with a pooled decoder.
+func decodePlanGist(gist string, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts []DecodeOption) (*Node, error) {
+	d := getDecoder(tableLookup, indexLookup, opts)
+	defer d.release()
+	return d.decodeGist(gist)
+}
+
+// Decoder decodes plan gists, reusing its base64 and node stack buffers from
+// one gist to the next. Unlike the package-level functions, which draw
+// decoders from an internal pool, a Decoder gives the caller explicit control
+// over reuse. A Decoder is not safe for concurrent use; give each goroutine
+// its own.
+type Decoder struct {
+	d planGistDecoder
+}
+
+// NewDecoder returns a Decoder that resolves names with the given lookups,
+// which may be nil, and applies opts to every gist it decodes.
+func NewDecoder(tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) *Decoder {
+	dec := &Decoder{}
+	dec.d.TableLookupFn = tableLookup
+	dec.d.IndexLookupFn = indexLookup
+	dec.d.config = defaultDecodeConfig()
+	for _, opt := range opts {
+		opt(&dec.d.config)
+	}
+	return dec
+}
+
+// Decode decodes gist like DecodePlanGist.
+func (dec *Decoder) Decode(gist string) (*Node, error) {
+	root, err := dec.d.decodeGist(gist)
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// DecodePlanGist decodes a base64-encoded CockroachDB plan gist into a plan tree.
+//
+// The tableLookup and indexLookup functions are optional. If nil or if they return
+// an empty string, table and index IDs will be shown as numbers (e.g., "112@1").
+// These functions should map CockroachDB internal IDs to human-readable names.
+//
+// Options such as WithMaxNodes adjust the decoding limits.
+//
+// Example:
+//
+//	node, err := DecodePlanGist(gist, tableLookup, indexLookup)
+//	if err != nil {
+//	    return err
+//	}
+//	output := FormatPlan(node)
+//	fmt.Print(output)
+func DecodePlanGist(gist string, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) (*Node, error) {
+	root, err := decodePlanGist(gist, tableLookup, indexLookup, opts)
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// DecodePlanGistContext is like DecodePlanGist, but stops decoding and
+// returns ctx.Err() if ctx is cancelled or its deadline passes. The context is
+// checked periodically between operators, which bounds the work spent on
+// unusually long or crafted gists.
+func DecodePlanGistContext(ctx context.Context, gist string, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) (*Node, error) {
+	d := getDecoder(tableLookup, indexLookup, opts)
+	defer d.release()
+	d.ctx = ctx
+	root, err := d.decodeGist(gist)
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// DecodePlanGistPartial is like DecodePlanGist, but when decoding fails midway
+// it returns the partial plan decoded so far along with the error instead of
+// discarding it. The partial plan is the most recently completed subtree, so
+// callers can show the operators that were decoded before the failure.
+//
+// The returned node may be nil if the failure occurred before any operator
+// was fully decoded.
+func DecodePlanGistPartial(gist string, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) (*Node, error) {
+	return decodePlanGist(gist, tableLookup, indexLookup, opts)
+}
+
+// DecodeResult is the outcome of decoding a gist with DecodePlanGistResult.
+type DecodeResult struct {
+	// Root is the decoded plan, or the partial plan decoded before a failure.
+	Root *Node
+	// UnsupportedOps holds the codes of operators the decoder has no layout
+	// for. Decoding stops at the first one, since its body can't be skipped,
+	// so it holds at most one code today.
+	UnsupportedOps []byte
+	// RawBytes is the base64-decoded gist, for comparing a gist that
+	// decodes incorrectly against CockroachDB's encoder byte by byte.
+	RawBytes []byte
+}
+
+// DecodePlanGistResult is like DecodePlanGistPartial, but also reports the
+// operators in the gist that the decoder doesn't support, so tools decoding
+// many gists can tally which operators are worth adding. The result is
+// returned even when decoding fails, unless the gist isn't valid base64.
+func DecodePlanGistResult(gist string, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) (*DecodeResult, error) {
+	d := getDecoder(tableLookup, indexLookup, opts)
+	defer d.release()
+	if err := d.reset(gist); err != nil {
+		return nil, err
+	}
+	root, err := d.decodePlan()
+	res := &DecodeResult{Root: root, RawBytes: append([]byte(nil), d.raw...)}
+	if len(d.unsupported) > 0 {
+		res.UnsupportedOps = append([]byte(nil), d.unsupported...)
+	}
+	return res, err
+}
+
+// DecodeReader is like DecodePlanGist, but reads the base64-encoded gist
+// from r until EOF, decoding the base64 as it is read instead of holding the
+// gist as a string first. Line breaks in the base64 are ignored, so r may
+// hold a single gist followed by a newline.
+func DecodeReader(r io.Reader, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) (*Node, error) {
+	return decodeReader(base64.NewDecoder(base64.StdEncoding, r), tableLookup, indexLookup, opts)
+}
+
+// DecodeRawReader is like DecodeReader, but reads the gist's binary
+// encoding, without base64, such as the bytes of a gist stored as BYTES.
+func DecodeRawReader(r io.Reader, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) (*Node, error) {
+	return decodeReader(r, tableLookup, indexLookup, opts)
+}
+
+// decodeReader decodes the binary gist read from r with a pooled decoder.
+func decodeReader(r io.Reader, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts []DecodeOption) (*Node, error) {
+	d := getDecoder(tableLookup, indexLookup, opts)
+	defer d.release()
+	if err := d.resetFrom(r); err != nil {
+		return nil, fmt.Errorf("read error: %w", err)
+	}
+	root, err := d.decodePlan()
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// DecodePlanGists decodes a batch of gists, such as the plan_gist values of
+// many statement_statistics rows. Unlike calling DecodePlanGist in a loop, a
+// single decoder and its buffers are reused for the whole batch.
+//
+// A failure to decode one gist does not stop the batch: the returned slices
+// are index-aligned with gists, holding the plan and a nil error for each
+// gist that decoded, and a nil plan and the error for each that did not.
+func DecodePlanGists(gists []string, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) ([]*Node, []error) {
+	nodes := make([]*Node, len(gists))
+	errs := make([]error, len(gists))
+
+	d := getDecoder(tableLookup, indexLookup, opts)
+	defer d.release()
+	for i, gist := range gists {
+		root, err := d.decodeGist(gist)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		nodes[i] = root
+	}
+	return nodes, errs
+}
+
+// DecodePlanGistsParallel is like DecodePlanGists, but spreads the batch
+// across workers goroutines, each reusing its own decoder, for decoding large
+// corpora on multi-core machines. The results are index-aligned with gists
+// regardless of the order in which they finish. A workers value of 0 or less
+// means runtime.GOMAXPROCS(0).
+//
+// The lookup functions are called from several goroutines at once, so they
+// must be safe for concurrent use.
+func DecodePlanGistsParallel(gists []string, workers int, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) ([]*Node, []error) {
+	nodes := make([]*Node, len(gists))
+	errs := make([]error, len(gists))
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(gists) {
+		workers = len(gists)
+	}
+	// Workers claim the next undecoded index until the batch is done, so a
+	// slow gist holds up only its own worker.
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			d := getDecoder(tableLookup, indexLookup, opts)
+			defer d.release()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(gists) {
+					return
+				}
+				root, err := d.decodeGist(gists[i])
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				nodes[i] = root
+			}
+		}()
+	}
+	wg.Wait()
+	return nodes, errs
+}
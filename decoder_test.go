@@ -1,10 +1,104 @@
 package gistdecoder
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 )
 
+// gistBuilder assembles synthetic gists for operators that have no real
+// CockroachDB gist in the tests. Values are written with the same encodings
+// the decoder reads them with.
+type gistBuilder struct {
+	buf bytes.Buffer
+}
+
+// newGistBuilder returns a builder with the gist version header written.
+func newGistBuilder() *gistBuilder {
+	b := &gistBuilder{}
+	return b.int(gistVersion)
+}
+
+func (b *gistBuilder) op(op execOperator) *gistBuilder {
+	return b.byte(byte(op))
+}
+
+func (b *gistBuilder) byte(v byte) *gistBuilder {
+	b.buf.WriteByte(v)
+	return b
+}
+
+func (b *gistBuilder) bool(v bool) *gistBuilder {
+	if v {
+		return b.byte(1)
+	}
+	return b.byte(0)
+}
+
+func (b *gistBuilder) int(v int) *gistBuilder {
+	b.buf.Write(binary.AppendVarint(nil, int64(v)))
+	return b
+}
+
+func (b *gistBuilder) uvarint(v uint64) *gistBuilder {
+	b.buf.Write(binary.AppendUvarint(nil, v))
+	return b
+}
+
+// emptyIntSet writes an intsets.Fast with no members.
+func (b *gistBuilder) emptyIntSet() *gistBuilder {
+	return b.uvarint(0).uvarint(0)
+}
+
+// intSet writes an intsets.Fast bitmap holding the given members, which must
+// be less than 64.
+func (b *gistBuilder) intSet(members ...int) *gistBuilder {
+	var bitmap uint64
+	for _, m := range members {
+		bitmap |= 1 << uint(m)
+	}
+	return b.uvarint(0).uvarint(bitmap)
+}
+
+// wideIntSet writes an intsets.Fast set of the members 0 to size-1 in the
+// encoding used for sets with members past 63: the length followed by each
+// member.
+func (b *gistBuilder) wideIntSet(size int) *gistBuilder {
+	b.uvarint(uint64(size))
+	for m := 0; m < size; m++ {
+		b.uvarint(uint64(m))
+	}
+	return b
+}
+
+// scan writes a scan operator with the given span, inverted span, and hard
+// limit values.
+func (b *gistBuilder) scan(table, index, spans, invertedSpans, hardLimit int) *gistBuilder {
+	return b.op(scanOp).int(table).int(index).emptyIntSet().int(spans).int(invertedSpans).int(hardLimit)
+}
+
+func (b *gistBuilder) String() string {
+	return base64.StdEncoding.EncodeToString(b.buf.Bytes())
+}
+
+// mustDecode decodes gist without lookups, failing the test on error.
+func mustDecode(t *testing.T, gist string) *Node {
+	t.Helper()
+	node, err := DecodePlanGist(gist, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode %q: %v", gist, err)
+	}
+	return node
+}
+
 func TestDecodePlanGist(t *testing.T) {
 	// This is a real gist from CockroachDB representing:
 	// UPDATE ... SET ... (with render and scan)
@@ -144,31 +238,1732 @@ func TestFormatPlan(t *testing.T) {
 	}
 }
 
-func TestFormatPlanNilNode(t *testing.T) {
-	output := FormatPlan(nil)
-	if output != "" {
-		t.Errorf("Expected empty string for nil node, got: %s", output)
+func TestDecodeFullScan(t *testing.T) {
+	node, err := DecodePlanGist(newGistBuilder().scan(112, 1, 0, 0, 0).String(), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	if fullScan, _ := node.args["full_scan"].(bool); !fullScan {
+		t.Errorf("Expected full_scan to be true, got %v", node.args["full_scan"])
+	}
+
+	output := FormatPlan(node)
+	if !strings.Contains(output, "spans: FULL SCAN\n") {
+		t.Errorf("Expected unlimited full scan, got:\n%s", output)
 	}
 }
 
-func BenchmarkDecodePlanGist(b *testing.B) {
-	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+func TestDecodeLimitedFullScan(t *testing.T) {
+	node, err := DecodePlanGist(newGistBuilder().scan(112, 1, 0, 0, 1).String(), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_, err := DecodePlanGist(gist, nil, nil)
-		if err != nil {
-			b.Fatal(err)
+	if fullScan, _ := node.args["full_scan"].(bool); !fullScan {
+		t.Errorf("Expected full_scan to be true, got %v", node.args["full_scan"])
+	}
+
+	output := FormatPlan(node)
+	if !strings.Contains(output, "spans: FULL SCAN (LIMITED)") {
+		t.Errorf("Expected limited full scan, got:\n%s", output)
+	}
+}
+
+func TestDecodeScanNeededColumns(t *testing.T) {
+	// SELECT a, b FROM wide_table, fetching 2 of its many columns.
+	gist := newGistBuilder().op(scanOp).int(112).int(1).intSet(1, 2).int(0).int(0).int(0).String()
+
+	node := mustDecode(t, gist)
+	if node.args["needed_cols"] != 2 {
+		t.Errorf("Expected 2 needed columns, got %v", node.args["needed_cols"])
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "  columns: 2\n") {
+		t.Errorf("Expected the needed column count in the output, got:\n%s", output)
+	}
+
+	// The real gist's scan of table 112 fetches 9 columns.
+	scan := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM").children[0].children[0].children[0]
+	if scan.op != scanOp || scan.args["needed_cols"] != 9 {
+		t.Errorf("Expected a scan of 9 columns, got %s %v", opName(scan.op), scan.args)
+	}
+}
+
+func TestDecodeIndexConstraint(t *testing.T) {
+	// SELECT * FROM users WHERE id IN (1, ..., 10): the gist records only that
+	// the scan is constrained, so the spans are shown as a lower bound.
+	node := mustDecode(t, newGistBuilder().scan(112, 1, 1, 0, 0).String())
+	if constrained, _ := node.args["index_constraint"].(bool); !constrained {
+		t.Errorf("Expected an index constraint, got %v", node.args)
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "  spans: 1+ spans\n") {
+		t.Errorf("Expected a bounded span count, got:\n%s", output)
+	}
+}
+
+func TestDecodeLockingScan(t *testing.T) {
+	// SELECT * FROM users WHERE id = 1 FOR UPDATE encodes no locking bytes,
+	// so the scan's parameters end at the hard limit and the next byte is the
+	// following operator.
+	gist := newGistBuilder().scan(112, 1, 1, 0, 0).op(renderOp).int(3).String()
+
+	node := mustDecode(t, gist)
+	if node.op != renderOp || node.args["columns"] != 3 || len(node.children) != 1 {
+		t.Fatalf("Expected a render of 3 columns over the scan, got %s", Summarize(node))
+	}
+	if _, ok := node.children[0].args["locking"]; ok {
+		t.Errorf("Expected no locking on the scan, got %v", node.children[0].args["locking"])
+	}
+}
+
+func TestDecodeApplyJoin(t *testing.T) {
+	// SELECT * FROM t WHERE EXISTS (SELECT * FROM u WHERE u.x = t.a LIMIT 1
+	// FOR UPDATE), whose correlated subquery can't be decorrelated. The
+	// right side is planned per row at execution time and isn't encoded.
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(applyJoinOp).byte(4).
+		op(renderOp).int(2).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != renderOp || len(node.children) != 1 {
+		t.Fatalf("Expected render at the root, got %s", Summarize(node))
+	}
+	apply := node.children[0]
+	if apply.op != applyJoinOp {
+		t.Fatalf("Expected an apply join under the render, got %s", opName(apply.op))
+	}
+	if apply.args["type"] != "semi" || apply.args["correlated"] != true {
+		t.Errorf("Expected a correlated semi apply join, got %v", apply.args)
+	}
+	if len(apply.children) != 1 || apply.children[0].op != scanOp {
+		t.Errorf("Expected the scan as the only input, got %v", apply.children)
+	}
+
+	output := FormatPlan(node)
+	for _, expected := range []string{"• apply join\n", "│ type: semi\n", "│ correlated\n"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
 		}
 	}
 }
 
-func BenchmarkFormatPlan(b *testing.B) {
-	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
-	node, _ := DecodePlanGist(gist, nil, nil)
+func TestDecodeSetOps(t *testing.T) {
+	// SELECT a FROM t INTERSECT SELECT a FROM u, planned as either set
+	// operator; neither has a body, so the kind of set operation is not
+	// known.
+	for op, strategy := range map[execOperator]string{hashSetOpOp: "hash", streamingSetOpOp: "streaming"} {
+		gist := newGistBuilder().scan(112, 1, 0, 0, 0).scan(113, 1, 0, 0, 0).op(op).String()
+		node := mustDecode(t, gist)
+		if node.op != op || len(node.children) != 2 {
+			t.Fatalf("Expected %s with 2 children, got %s with %d", opName(op), opName(node.op), len(node.children))
+		}
+		if node.args["strategy"] != strategy {
+			t.Errorf("Expected strategy %q, got %v", strategy, node.args["strategy"])
+		}
+		if node.children[0].args["table_id"] != int64(112) || node.children[1].args["table_id"] != int64(113) {
+			t.Errorf("Expected the inputs in gist order, got %v and %v", node.children[0].args, node.children[1].args)
+		}
+	}
+}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_ = FormatPlan(node)
+func TestDecodeScanHardLimit(t *testing.T) {
+	// SELECT * FROM t WHERE a > 10 LIMIT 100, with the limit pushed into the
+	// constrained scan. The gist only flags that the scan is limited.
+	node := mustDecode(t, newGistBuilder().scan(112, 1, 1, 0, 1).String())
+	if limited, _ := node.args["hard_limit"].(bool); !limited {
+		t.Errorf("Expected a hard limit, got %v", node.args)
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "  limit\n") {
+		t.Errorf("Expected the limit in the output, got:\n%s", output)
+	}
+
+	node = mustDecode(t, newGistBuilder().scan(112, 1, 0, 0, 1).String())
+	if output := FormatPlan(node); !strings.Contains(output, "  spans: FULL SCAN (LIMITED)\n") {
+		t.Errorf("Expected a limited full scan, got:\n%s", output)
+	}
+
+	node = mustDecode(t, newGistBuilder().scan(112, 1, 1, 0, 0).String())
+	if _, ok := node.args["hard_limit"]; ok {
+		t.Errorf("Expected no hard limit, got %v", node.args["hard_limit"])
+	}
+}
+
+func TestDecodeInvertedConstraintScan(t *testing.T) {
+	node, err := DecodePlanGist(newGistBuilder().scan(112, 2, 0, 1, 0).String(), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	if fullScan, _ := node.args["full_scan"].(bool); fullScan {
+		t.Error("Expected an inverted-constraint scan not to be a full scan")
+	}
+
+	output := FormatPlan(node)
+	if strings.Contains(output, "FULL SCAN") {
+		t.Errorf("Expected no FULL SCAN label, got:\n%s", output)
+	}
+	if !strings.Contains(output, "  inverted constraint\n") {
+		t.Errorf("Expected the inverted constraint to be shown, got:\n%s", output)
+	}
+}
+
+func TestDecodePlanGistTruncated(t *testing.T) {
+	// A scan followed by a render whose column count is missing.
+	gist := newGistBuilder().scan(112, 1, 1, 0, 0).op(renderOp).String()
+
+	node, err := DecodePlanGist(gist, nil, nil)
+	if err == nil {
+		t.Fatal("Expected error for truncated gist")
+	}
+	if node != nil {
+		t.Errorf("Expected nil node on error, got %v", node)
+	}
+}
+
+func TestDecodeIgnoresBytesAfterTerminator(t *testing.T) {
+	// Gists carry no row estimates; bytes after the terminating zero op are
+	// not decoded as a trailing section.
+	gist := newGistBuilder().scan(112, 1, 1, 0, 0).byte(0).int(42).int(7).String()
+
+	node := mustDecode(t, gist)
+	if node.op != scanOp || len(node.children) != 0 {
+		t.Fatalf("Expected a lone scan, got %s with %d children", opName(node.op), len(node.children))
+	}
+	if _, ok := node.args["estimated_rows"]; ok {
+		t.Errorf("Expected no estimated_rows, got %v", node.args["estimated_rows"])
+	}
+	if output := FormatPlan(node); strings.Contains(output, "estimated row count") {
+		t.Errorf("Expected no row estimate in the output, got:\n%s", output)
+	}
+}
+
+func TestDecodePlanGistTruncatedOffset(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *gistBuilder
+		// unread is how many bytes before the end the failing read starts.
+		unread int
+		wantOp execOperator
+		// wantErr is the error the DecodeError wraps, if it is a sentinel,
+		// and wantMsg a part of its message otherwise.
+		wantErr error
+		wantMsg string
+	}{
+		{
+			// The render's column count is missing entirely.
+			name:    "missing field",
+			b:       newGistBuilder().scan(112, 1, 1, 0, 0).op(renderOp),
+			unread:  0,
+			wantOp:  renderOp,
+			wantErr: io.EOF,
+		},
+		{
+			// The scan's table ID ends partway through its varint.
+			name:    "partial varint",
+			b:       newGistBuilder().op(scanOp).byte(0x80),
+			unread:  1,
+			wantOp:  scanOp,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			// The scan's needed columns claim two members but hold one.
+			name:    "truncated intset",
+			b:       newGistBuilder().op(scanOp).int(112).int(1).uvarint(2).uvarint(70),
+			unread:  0,
+			wantOp:  scanOp,
+			wantErr: io.EOF,
+		},
+		{
+			// The scan's needed columns claim 2^40 members; the failing read
+			// is the set's length.
+			name:    "oversized intset",
+			b:       newGistBuilder().op(scanOp).int(112).int(1).uvarint(1 << 40),
+			unread:  6,
+			wantOp:  scanOp,
+			wantMsg: "intset has 1099511627776 members, more than 65536",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantOffset := tt.b.buf.Len() - tt.unread
+
+			_, err := DecodePlanGist(tt.b.String(), nil, nil)
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("Expected a DecodeError, got %v", err)
+			}
+			if decodeErr.Offset != wantOffset {
+				t.Errorf("Expected offset %d, got %d", wantOffset, decodeErr.Offset)
+			}
+			if decodeErr.Op != tt.wantOp {
+				t.Errorf("Expected operator %s, got %s", opName(tt.wantOp), opName(decodeErr.Op))
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error to wrap %v, got %v", tt.wantErr, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("Expected error to contain %q, got %q", tt.wantMsg, err.Error())
+			}
+			want := fmt.Sprintf("decode error at byte offset %d in %s", wantOffset, opName(tt.wantOp))
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("Expected error to contain %q, got %q", want, err.Error())
+			}
+		})
+	}
+}
+
+func TestDecodePlanGistStackImbalance(t *testing.T) {
+	// Two scans that no operator consumes leave the plan without a single
+	// root.
+	gist := newGistBuilder().scan(112, 1, 1, 0, 0).scan(113, 1, 0, 0, 0).String()
+
+	if _, err := DecodePlanGist(gist, nil, nil); !errors.Is(err, ErrStackImbalance) {
+		t.Fatalf("Expected ErrStackImbalance, got %v", err)
+	}
+	node, err := DecodePlanGistPartial(gist, nil, nil)
+	if !errors.Is(err, ErrStackImbalance) || !strings.Contains(err.Error(), "ends with 2 subtrees") {
+		t.Errorf("Expected an imbalance of 2 subtrees, got %v", err)
+	}
+	if node == nil || node.args["table_id"] != int64(113) {
+		t.Errorf("Expected the last scan as the partial plan, got %v", node)
+	}
+}
+
+func TestDecodePlanGistStackImbalanceWithChecks(t *testing.T) {
+	// Two values under a check leave two subtrees where the main plan should
+	// be; the first must not be dropped silently.
+	gist := newGistBuilder().
+		op(valuesOp).int(1).int(1).
+		op(valuesOp).int(1).int(1).
+		op(scanBufferOp).int(1).
+		op(errorIfRowsOp).
+		String()
+	if _, err := DecodePlanGist(gist, nil, nil); !errors.Is(err, ErrStackImbalance) || !strings.Contains(err.Error(), "ends with 2 subtrees") {
+		t.Errorf("Expected an imbalance of 2 subtrees, got %v", err)
+	}
+
+	// A check alone leaves no main plan at all.
+	gist = newGistBuilder().op(scanBufferOp).int(1).op(errorIfRowsOp).String()
+	node, err := DecodePlanGist(gist, nil, nil)
+	if !errors.Is(err, ErrStackImbalance) || !strings.Contains(err.Error(), "no main plan") {
+		t.Errorf("Expected an imbalance for the missing main plan, got %v", err)
+	}
+	if node != nil {
+		t.Errorf("Expected no plan, got %v", node)
+	}
+}
+
+func TestDecodePlanGistRepanicsBugs(t *testing.T) {
+	// A nil dereference in a lookup is a bug, not a corrupt gist, so it must
+	// not come back as a decode error.
+	var names map[int64]*string
+	tableLookup := func(id int64) string { return *names[id] }
+
+	defer func() {
+		r := recover()
+		if _, ok := r.(runtime.Error); !ok {
+			t.Errorf("Expected the runtime error to be re-panicked, got %v", r)
+		}
+	}()
+	node, err := DecodePlanGist("AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM", tableLookup, nil)
+	t.Errorf("Expected a panic, got %v, %v", node, err)
+}
+
+func TestDecodePlanGistPartial(t *testing.T) {
+	gist := newGistBuilder().scan(112, 1, 1, 0, 0).op(renderOp).String()
+
+	node, err := DecodePlanGistPartial(gist, nil, nil)
+	if err == nil {
+		t.Fatal("Expected error for truncated gist")
+	}
+	if node == nil {
+		t.Fatal("Expected partial plan alongside the error")
+	}
+	if node.op != scanOp {
+		t.Errorf("Expected partial plan to be the decoded scan, got %v", node.op)
+	}
+}
+
+func TestDecodePlanGistPartialSuccess(t *testing.T) {
+	node, err := DecodePlanGistPartial("AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if node == nil || node.op != updateOp {
+		t.Errorf("Expected update root, got %v", node)
+	}
+}
+
+func TestDecodeBufferAndScanBuffer(t *testing.T) {
+	// WITH cte AS (SELECT ...) SELECT ... FROM cte JOIN cte ON ...
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(bufferOp).int(1).
+		op(scanBufferOp).int(1).
+		op(scanBufferOp).int(1).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		String()
+
+	// Nothing consumes the buffer, so it is left under the join and the
+	// partial plan is the join.
+	node, err := DecodePlanGistPartial(gist, nil, nil)
+	if !errors.Is(err, ErrStackImbalance) {
+		t.Fatalf("Expected ErrStackImbalance for the unconsumed buffer, got %v", err)
+	}
+	if node.op != hashJoinOp {
+		t.Fatalf("Expected hash join root, got %v", node.op)
+	}
+	if len(node.children) != 2 {
+		t.Fatalf("Expected 2 children, got %d", len(node.children))
+	}
+	for i, child := range node.children {
+		if child.op != scanBufferOp {
+			t.Errorf("Expected child %d to be a scan buffer, got %v", i, child.op)
+		}
+		if id := child.args["buffer_id"]; id != 1 {
+			t.Errorf("Expected child %d to reference buffer 1, got %v", i, id)
+		}
+		if len(child.children) != 0 {
+			t.Errorf("Expected scan buffer to be a leaf, got %d children", len(child.children))
+		}
+	}
+
+	if output := FormatPlan(node); !strings.Contains(output, "label: buffer 1") {
+		t.Errorf("Expected buffer label in output, got:\n%s", output)
+	}
+}
+
+func TestDecodeBuffer(t *testing.T) {
+	gist := newGistBuilder().scan(112, 1, 0, 0, 0).op(bufferOp).int(3).String()
+
+	node, err := DecodePlanGist(gist, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if node.op != bufferOp || node.args["buffer_id"] != 3 {
+		t.Fatalf("Expected buffer 3 root, got %v %v", node.op, node.args)
+	}
+	if len(node.children) != 1 || node.children[0].op != scanOp {
+		t.Errorf("Expected buffer to wrap the scan, got %v", node.children)
+	}
+}
+
+func TestDecodeWindow(t *testing.T) {
+	gist := newGistBuilder().scan(112, 1, 0, 0, 0).op(windowOp).op(renderOp).int(2).String()
+
+	node, err := DecodePlanGist(gist, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if node.op != renderOp || len(node.children) != 1 {
+		t.Fatalf("Expected render root with one child, got %v", node)
+	}
+	window := node.children[0]
+	if window.op != windowOp || len(window.children) != 1 || window.children[0].op != scanOp {
+		t.Errorf("Expected window over scan, got %v", window)
+	}
+}
+
+func TestDecodeRecursiveCTE(t *testing.T) {
+	// WITH RECURSIVE nums(n) AS (SELECT 1 UNION SELECT n+1 FROM nums WHERE n < 10)
+	// SELECT n FROM nums
+	//
+	// The recursive input is planned on each iteration, so the gist holds
+	// only the initial values input followed by the deduplicate flag.
+	gist := newGistBuilder().
+		op(valuesOp).int(1).int(1).
+		op(recursiveCTEOp).bool(true).
+		String()
+
+	node, err := DecodePlanGist(gist, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if node.op != recursiveCTEOp {
+		t.Fatalf("Expected recursive cte root, got %v", node.op)
+	}
+	if dedup, _ := node.args["deduplicate"].(bool); !dedup {
+		t.Errorf("Expected deduplicate to be set, got %v", node.args)
+	}
+	if len(node.children) != 1 || node.children[0].op != valuesOp {
+		t.Fatalf("Expected a single values input, got %v", node.children)
+	}
+
+	output := FormatPlan(node)
+	for _, expected := range []string{"• recursive cte", "│ deduplicate", "└── • values"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestDecodeWindowFrameExclusion(t *testing.T) {
+	// SELECT sum(v) OVER (ORDER BY k ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING
+	// EXCLUDE CURRENT ROW) FROM t
+	//
+	// Frame exclusion is not part of the gist, so the window operator must not
+	// consume any bytes: the render that follows it has to decode intact.
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(windowOp).
+		op(renderOp).int(3).
+		String()
+
+	node, err := DecodePlanGist(gist, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if node.op != renderOp || node.args["columns"] != 3 {
+		t.Fatalf("Expected render with 3 columns as root, got %v %v", node.op, node.args)
+	}
+	window := node.children[0]
+	if window.op != windowOp || len(window.args) != 0 {
+		t.Errorf("Expected window without decoded args, got %v %v", window.op, window.args)
+	}
+}
+
+func TestDecodeScanParamsLayout(t *testing.T) {
+	// In this real gist the scan's parameters are immediately followed by the
+	// render operator, so a scan over a multi-family table carries no family
+	// information. Decoding any extra scan bytes would corrupt the render.
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+
+	render := node.children[0].children[0]
+	if render.op != renderOp {
+		t.Fatalf("Expected render node, got %v", render.op)
+	}
+	if render.args["columns"] != 10 {
+		t.Errorf("Expected render to have 10 columns, got %v", render.args["columns"])
+	}
+
+	scan := render.children[0]
+	for _, key := range []string{"families", "column_families"} {
+		if _, ok := scan.args[key]; ok {
+			t.Errorf("Expected no %s arg on scan", key)
+		}
+	}
+}
+
+func TestDecodePlanGists(t *testing.T) {
+	gists := []string{
+		"AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM",
+		"not-valid-base64!",
+		newGistBuilder().scan(113, 2, 0, 0, 0).String(),
+		newGistBuilder().scan(112, 1, 1, 0, 0).op(renderOp).String(),
+	}
+
+	nodes, errs := DecodePlanGists(gists, nil, nil)
+	if len(nodes) != len(gists) || len(errs) != len(gists) {
+		t.Fatalf("Expected %d results, got %d nodes and %d errors", len(gists), len(nodes), len(errs))
+	}
+
+	if errs[0] != nil || nodes[0] == nil || nodes[0].op != updateOp {
+		t.Errorf("Expected gist 0 to decode to an update, got %v, %v", nodes[0], errs[0])
+	}
+	if errs[1] == nil || nodes[1] != nil {
+		t.Errorf("Expected gist 1 to fail, got %v, %v", nodes[1], errs[1])
+	}
+	if errs[2] != nil || nodes[2] == nil || nodes[2].args["table_id"] != int64(113) {
+		t.Errorf("Expected gist 2 to decode to a scan of 113, got %v, %v", nodes[2], errs[2])
+	}
+	if errs[3] == nil || nodes[3] != nil {
+		t.Errorf("Expected truncated gist 3 to fail, got %v, %v", nodes[3], errs[3])
+	}
+}
+
+func TestDecodePlanGistsParallel(t *testing.T) {
+	var gists []string
+	for i := 0; i < 1000; i++ {
+		switch i % 4 {
+		case 0:
+			gists = append(gists, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+		case 1:
+			gists = append(gists, "not-valid-base64!")
+		case 2:
+			gists = append(gists, newGistBuilder().scan(100+i, 1, i%3, 0, 0).String())
+		case 3:
+			gists = append(gists, newGistBuilder().scan(100+i, 1, 1, 0, 0).op(renderOp).String())
+		}
+	}
+	wantNodes, wantErrs := DecodePlanGists(gists, nil, nil)
+
+	for _, workers := range []int{0, 1, 8, 2000} {
+		nodes, errs := DecodePlanGistsParallel(gists, workers, nil, nil)
+		if len(nodes) != len(gists) || len(errs) != len(gists) {
+			t.Fatalf("workers=%d: expected %d results, got %d nodes and %d errors", workers, len(gists), len(nodes), len(errs))
+		}
+		for i := range gists {
+			if !Equal(nodes[i], wantNodes[i]) {
+				t.Errorf("workers=%d: expected gist %d to decode to %s, got %s", workers, i, Summarize(wantNodes[i]), Summarize(nodes[i]))
+			}
+			if (errs[i] == nil) != (wantErrs[i] == nil) || (errs[i] != nil && errs[i].Error() != wantErrs[i].Error()) {
+				t.Errorf("workers=%d: expected gist %d error %v, got %v", workers, i, wantErrs[i], errs[i])
+			}
+		}
+	}
+
+	if nodes, errs := DecodePlanGistsParallel(nil, 4, nil, nil); len(nodes) != 0 || len(errs) != 0 {
+		t.Errorf("Expected no results for an empty batch, got %d nodes and %d errors", len(nodes), len(errs))
+	}
+}
+
+func TestDecodePlanGistContext(t *testing.T) {
+	node, err := DecodePlanGistContext(context.Background(), "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if node.op != updateOp {
+		t.Errorf("Expected update root, got %v", node.op)
+	}
+}
+
+func TestDecodePlanGistContextCancelled(t *testing.T) {
+	b := newGistBuilder()
+	for i := 0; i < 1000; i++ {
+		b.op(valuesOp).int(1).int(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	node, err := DecodePlanGistContext(ctx, b.String(), nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if node != nil {
+		t.Errorf("Expected nil node when cancelled, got %v", node)
+	}
+}
+
+func TestDecodePlanGistMaxNodes(t *testing.T) {
+	b := newGistBuilder().op(valuesOp).int(1).int(1)
+	for i := 0; i < DefaultMaxNodes; i++ {
+		b.op(renderOp).int(1)
+	}
+
+	_, err := DecodePlanGist(b.String(), nil, nil)
+	if !errors.Is(err, ErrMaxNodesExceeded) {
+		t.Fatalf("Expected ErrMaxNodesExceeded, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "plan exceeds max nodes") {
+		t.Errorf("Expected descriptive error, got %v", err)
+	}
+
+	if _, err := DecodePlanGist(b.String(), nil, nil, WithMaxNodes(0)); err != nil {
+		t.Errorf("Expected no error with the limit disabled, got %v", err)
+	}
+}
+
+func TestDecodePlanGistWithMaxNodes(t *testing.T) {
+	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM" // 4 operators
+
+	if _, err := DecodePlanGist(gist, nil, nil, WithMaxNodes(4)); err != nil {
+		t.Errorf("Expected 4 operators to fit, got %v", err)
+	}
+	if _, err := DecodePlanGist(gist, nil, nil, WithMaxNodes(3)); !errors.Is(err, ErrMaxNodesExceeded) {
+		t.Errorf("Expected ErrMaxNodesExceeded with a limit of 3, got %v", err)
+	}
+}
+
+func TestDecodePlanGistVersion(t *testing.T) {
+	// The same scan under a version 1 header and a crafted version 2 header.
+	// The bodies are identical: a later version differing only in additive
+	// changes decodes with the version 1 layout once it is accepted.
+	v1 := newGistBuilder().scan(112, 1, 1, 0, 0).String()
+	v2 := (&gistBuilder{}).int(2).scan(112, 1, 1, 0, 0).String()
+
+	if _, err := DecodePlanGist(v1, nil, nil); err != nil {
+		t.Errorf("Expected version 1 to decode, got %v", err)
+	}
+
+	_, err := DecodePlanGist(v2, nil, nil)
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "unsupported gist version 2") {
+		t.Errorf("Expected the error to name version 2, got %v", err)
+	}
+
+	node, err := DecodePlanGist(v2, nil, nil, WithMaxVersion(2))
+	if err != nil {
+		t.Fatalf("Expected version 2 to decode with WithMaxVersion(2), got %v", err)
+	}
+	if node.op != scanOp || node.args["table_id"] != int64(112) {
+		t.Errorf("Expected a scan of table 112, got %s %v", opName(node.op), node.args)
+	}
+
+	if _, err := DecodePlanGist(v1, nil, nil, WithMinVersion(2), WithMaxVersion(2)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected version 1 to be rejected with WithMinVersion(2), got %v", err)
+	}
+
+	v0 := (&gistBuilder{}).int(0).String()
+	if _, err := DecodePlanGist(v0, nil, nil, WithMinVersion(0)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected version 0 to be rejected, got %v", err)
+	}
+}
+
+func TestDecodePlanGistUnknownOperator(t *testing.T) {
+	// A scan followed by an operator code the decoder has no layout for.
+	b := newGistBuilder().scan(112, 1, 1, 0, 0)
+	offset := b.buf.Len()
+	gist := b.byte(200).int(7).String()
+
+	node, err := DecodePlanGistPartial(gist, nil, nil)
+	if !errors.Is(err, ErrUnknownOperator) {
+		t.Fatalf("Expected ErrUnknownOperator, got %v", err)
+	}
+	expected := fmt.Sprintf("op_200 (code 200) at byte offset %d", offset)
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error to contain %q, got %v", expected, err)
+	}
+	if node == nil || node.op != scanOp {
+		t.Errorf("Expected the scan decoded before the unknown operator, got %v", node)
+	}
+}
+
+func TestDecodePlanGistResultUnsupportedOps(t *testing.T) {
+	gist := newGistBuilder().scan(112, 1, 1, 0, 0).op(vectorSearchOp).String()
+
+	res, err := DecodePlanGistResult(gist, nil, nil)
+	if !errors.Is(err, ErrUnknownOperator) {
+		t.Fatalf("Expected ErrUnknownOperator, got %v", err)
+	}
+	if res == nil {
+		t.Fatal("Expected a result alongside the error")
+	}
+	if !bytes.Equal(res.UnsupportedOps, []byte{byte(vectorSearchOp)}) {
+		t.Errorf("Expected unsupported ops [%d], got %v", vectorSearchOp, res.UnsupportedOps)
+	}
+	if res.Root == nil || res.Root.op != scanOp {
+		t.Errorf("Expected the scan decoded before the unsupported operator, got %v", res.Root)
+	}
+
+	res, err = DecodePlanGistResult(newGistBuilder().scan(112, 1, 1, 0, 0).String(), nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(res.UnsupportedOps) != 0 {
+		t.Errorf("Expected no unsupported ops, got %v", res.UnsupportedOps)
+	}
+}
+
+func TestDecodePlanGistResultRawBytes(t *testing.T) {
+	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+	expected, err := base64.StdEncoding.DecodeString(gist)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := DecodePlanGistResult(gist, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(res.RawBytes, expected) {
+		t.Errorf("Expected raw bytes %x, got %x", expected, res.RawBytes)
+	}
+
+	// The bytes are the caller's to keep once the decoder is reused.
+	other, _ := DecodePlanGistResult(newGistBuilder().scan(112, 1, 0, 0, 0).String(), nil, nil)
+	if !bytes.Equal(res.RawBytes, expected) || bytes.Equal(other.RawBytes, expected) {
+		t.Errorf("Expected each result to hold its own bytes, got %x and %x", res.RawBytes, other.RawBytes)
+	}
+}
+
+func TestDecodeOrdinalityAndMax1Row(t *testing.T) {
+	gist := newGistBuilder().
+		scan(112, 1, 1, 0, 0).
+		op(ordinalityOp).
+		op(max1RowOp).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != max1RowOp || len(node.children) != 1 {
+		t.Fatalf("Expected max1Row with one child, got %s with %d children", opName(node.op), len(node.children))
+	}
+	if child := node.children[0]; child.op != ordinalityOp || len(child.children) != 1 {
+		t.Errorf("Expected ordinality over the scan, got %s with %d children", opName(child.op), len(child.children))
+	}
+}
+
+func TestDecoderReuse(t *testing.T) {
+	tableLookup := func(id int64) string {
+		if id == 112 {
+			return "users"
+		}
+		return ""
+	}
+	dec := NewDecoder(tableLookup, nil, WithMaxNodes(4))
+
+	node, err := dec.Decode("AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if node.args["table"] != "users" {
+		t.Errorf("Expected the table lookup to be used, got %v", node.args["table"])
+	}
+
+	// A failed gist doesn't affect the next one.
+	if _, err := dec.Decode("not base64!"); err == nil {
+		t.Error("Expected an error for invalid base64")
+	}
+	five := newGistBuilder().scan(112, 1, 1, 0, 0).op(filterOp).op(filterOp).op(filterOp).op(filterOp).String()
+	if _, err := dec.Decode(five); !errors.Is(err, ErrMaxNodesExceeded) {
+		t.Errorf("Expected the max nodes option to apply, got %v", err)
+	}
+
+	node, err = dec.Decode(newGistBuilder().scan(113, 1, 1, 0, 0).String())
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if node.op != scanOp || node.args["table"] != "113" || len(node.children) != 0 {
+		t.Errorf("Expected a lone scan of 113, got %s", Summarize(node))
+	}
+}
+
+func TestDecodePlanGistStackUnderflow(t *testing.T) {
+	// A filter with no input to filter.
+	gist := newGistBuilder().op(filterOp).String()
+
+	_, err := DecodePlanGist(gist, nil, nil)
+	if !errors.Is(err, ErrStackUnderflow) {
+		t.Fatalf("Expected ErrStackUnderflow, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "filter expects an input") {
+		t.Errorf("Expected error to name the operator, got %v", err)
+	}
+
+	// A hash join with only one input.
+	gist = newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		String()
+	if _, err := DecodePlanGist(gist, nil, nil); !errors.Is(err, ErrStackUnderflow) {
+		t.Errorf("Expected ErrStackUnderflow for a join with one input, got %v", err)
+	}
+}
+
+func TestDecodePlanGistEmpty(t *testing.T) {
+	node, err := DecodePlanGist(newGistBuilder().String(), nil, nil)
+	if err != nil {
+		t.Fatalf("Expected no error for an empty plan, got %v", err)
+	}
+	if node != nil {
+		t.Errorf("Expected nil node for an empty plan, got %v", node)
+	}
+}
+
+func TestDecodeColumnOrdinalsLength(t *testing.T) {
+	// The real gist's simple project lists 10 column ordinals, and the update
+	// only decodes if nothing but their count was read.
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+	if node.op != updateOp || node.args["table_id"] != int64(112) {
+		t.Fatalf("Expected an update of table 112 at the root, got %s %v", opName(node.op), node.args)
+	}
+	project := node.children[0]
+	if project.op != simpleProjectOp {
+		t.Fatalf("Expected a simple project under the update, got %s", opName(project.op))
+	}
+	if project.args["columns"] != 10 {
+		t.Errorf("Expected the simple project to have 10 columns, got %v", project.args["columns"])
+	}
+}
+
+func TestDecodeIndexJoinKeyColumns(t *testing.T) {
+	// SELECT * FROM users WHERE email = 'a@b.c': a scan of the secondary
+	// index users_email_idx joined back to the primary index on its two
+	// primary key columns.
+	gist := newGistBuilder().scan(112, 2, 1, 0, 0).
+		op(indexJoinOp).int(112).int(2).String()
+
+	node := mustDecode(t, gist)
+	if node.op != indexJoinOp || node.args["key_cols"] != 2 {
+		t.Fatalf("Expected an index join with 2 key columns, got %s %v", opName(node.op), node.args)
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "│ key cols: 2\n") {
+		t.Errorf("Expected the key cols line, got:\n%s", output)
+	}
+	if output := FormatPlanWithOptions(node, FormatOptions{CockroachCompat: true}); strings.Contains(output, "key cols") {
+		t.Errorf("Expected no key cols line in compat mode, got:\n%s", output)
+	}
+}
+
+func TestDecodeMergeJoinEqualityColumns(t *testing.T) {
+	// SELECT * FROM a JOIN b ON a.x = b.x AND a.y = b.y, with both inputs
+	// ordered on (x, y).
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(113, 1, 0, 0, 0).
+		op(mergeJoinOp).byte(0).int(2).int(2).bool(true).bool(false).
+		op(renderOp).int(4).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != renderOp {
+		t.Fatalf("Expected render root, got %v", node.op)
+	}
+	join := node.children[0]
+	if join.op != mergeJoinOp {
+		t.Fatalf("Expected merge join, got %v", join.op)
+	}
+	if join.args["left_eq_cols"] != 2 || join.args["right_eq_cols"] != 2 {
+		t.Errorf("Expected 2 equality columns on each side, got %v", join.args)
+	}
+	if leftKey, _ := join.args["left_key"].(bool); !leftKey {
+		t.Errorf("Expected left_key to be set, got %v", join.args)
+	}
+
+	output := FormatPlan(node)
+	for _, expected := range []string{"equality cols: 2", "left cols are key"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "right cols are key") {
+		t.Errorf("Expected right cols not to be key, got:\n%s", output)
+	}
+}
+
+func TestDecodeLookupJoinEqualityColumns(t *testing.T) {
+	gist := newGistBuilder().
+		scan(112, 1, 1, 0, 0).
+		op(lookupJoinOp).byte(0).int(113).int(1).int(2).bool(true).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.args["equality_cols"] != 2 {
+		t.Errorf("Expected 2 equality columns, got %v", node.args["equality_cols"])
+	}
+	if eqColsAreKey, _ := node.args["eq_cols_are_key"].(bool); !eqColsAreKey {
+		t.Errorf("Expected eq_cols_are_key to be set, got %v", node.args)
+	}
+
+	output := FormatPlan(node)
+	for _, expected := range []string{"│ table: 113@1", "│ equality cols: 2", "│ equality cols are key"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestDecodeLookupJoinRemoteLookup(t *testing.T) {
+	// A multi-region lookup join that may read from remote regions encodes no
+	// remote lookup bytes, so the join's body ends at eqColsAreKey and the
+	// next byte is the following operator.
+	gist := newGistBuilder().
+		scan(112, 1, 1, 0, 0).
+		op(lookupJoinOp).byte(0).int(113).int(2).int(1).bool(false).
+		op(renderOp).int(3).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != renderOp || node.args["columns"] != 3 || len(node.children) != 1 {
+		t.Fatalf("Expected a render of 3 columns over the lookup join, got %s", Summarize(node))
+	}
+	if _, ok := node.children[0].args["remote_lookup"]; ok {
+		t.Errorf("Expected no remote lookup on the join, got %v", node.children[0].args["remote_lookup"])
+	}
+}
+
+func TestDecodeDistinctErrorOnDuplicate(t *testing.T) {
+	// CREATE UNIQUE INDEX validates uniqueness with a distinct that errors on
+	// duplicate rows, but the mode has no bytes in the gist: the next byte
+	// after the distinct is the following operator.
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(distinctOp).
+		op(renderOp).int(2).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != renderOp || node.args["columns"] != 2 || len(node.children) != 1 {
+		t.Fatalf("Expected a render of 2 columns over the distinct, got %s", Summarize(node))
+	}
+	if distinct := node.children[0]; distinct.op != distinctOp || len(distinct.args) != 0 {
+		t.Errorf("Expected a distinct with no arguments, got %s %v", opName(distinct.op), distinct.args)
+	}
+}
+
+func TestDecodeTopK(t *testing.T) {
+	// SELECT * FROM t ORDER BY x LIMIT 5
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(topKOp).int(5).
+		op(renderOp).int(3).
+		String()
+
+	node := mustDecode(t, gist)
+	topK := node.children[0]
+	if topK.op != topKOp {
+		t.Fatalf("Expected top-k under render, got %v", topK.op)
+	}
+	if topK.args["k"] != 5 {
+		t.Errorf("Expected k 5, got %v", topK.args)
+	}
+	if node.args["columns"] != 3 {
+		t.Errorf("Expected the render after the top-k to decode intact, got %v", node.args)
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "│ k: 5\n") {
+		t.Errorf("Expected output to contain k, got:\n%s", output)
+	}
+}
+
+func TestDecodeGroupBy(t *testing.T) {
+	tests := []struct {
+		name      string
+		ordering  int
+		ordered   bool
+		formatted string
+	}{
+		// SELECT a, b, count(*) FROM t GROUP BY a, b with an unordered input.
+		{name: "hash", ordering: 0, ordered: false, formatted: "│ group by: 2 cols (hash)\n"},
+		// The same query when the input is sorted on the grouping columns.
+		{name: "streaming", ordering: 2, ordered: true, formatted: "│ group by: 2 cols (streaming)\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gist := newGistBuilder().
+				scan(112, 1, 0, 0, 0).
+				op(groupByOp).int(2).int(tt.ordering).
+				op(renderOp).int(3).
+				String()
+
+			node := mustDecode(t, gist)
+			groupBy := node.children[0]
+			if groupBy.op != groupByOp {
+				t.Fatalf("Expected group by under render, got %v", groupBy.op)
+			}
+			if groupBy.args["group_cols"] != 2 || groupBy.args["ordered"] != tt.ordered {
+				t.Errorf("Expected 2 grouping columns with ordered %v, got %v", tt.ordered, groupBy.args)
+			}
+			if node.args["columns"] != 3 {
+				t.Errorf("Expected the render after the group by to decode intact, got %v", node.args)
+			}
+			if output := FormatPlan(node); !strings.Contains(output, tt.formatted) {
+				t.Errorf("Expected output to contain %q, got:\n%s", tt.formatted, output)
+			}
+		})
+	}
+}
+
+func TestDecodeCreateTableAs(t *testing.T) {
+	// CREATE TABLE x AS SELECT a, b FROM t, created in schema 105.
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(renderOp).int(2).
+		op(createTableAsOp).int(105).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != createTableAsOp {
+		t.Fatalf("Expected create table as, got %s", opName(node.op))
+	}
+	if node.args["schema_id"] != int64(105) {
+		t.Errorf("Expected schema 105, got %v", node.args["schema_id"])
+	}
+	if len(node.children) != 1 || node.children[0].op != renderOp {
+		t.Fatalf("Expected the SELECT plan as the only child, got %v", node.children)
+	}
+	if scan := node.children[0].children[0]; scan.op != scanOp || scan.args["table_id"] != int64(112) {
+		t.Errorf("Expected the SELECT to scan table 112, got %s %v", opName(scan.op), scan.args)
+	}
+
+	output := FormatPlan(node)
+	for _, expected := range []string{"• create table as", "│ schema: 105", "• scan"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestDecodeCreateTable(t *testing.T) {
+	gist := newGistBuilder().op(createTableOp).int(105).String()
+
+	node := mustDecode(t, gist)
+	if node.op != createTableOp || len(node.children) != 0 {
+		t.Fatalf("Expected a create table leaf, got %s with %d children", opName(node.op), len(node.children))
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "  schema: 105") {
+		t.Errorf("Expected the schema in the output, got:\n%s", output)
+	}
+}
+
+func TestDecodeExport(t *testing.T) {
+	// EXPORT INTO CSV 'nodelocal://1/t' FROM SELECT a, b FROM t.
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(renderOp).int(2).
+		op(exportOp).intSet(0).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != exportOp {
+		t.Fatalf("Expected export, got %s", opName(node.op))
+	}
+	if node.args["not_null_cols"] != 1 {
+		t.Errorf("Expected 1 not null column, got %v", node.args["not_null_cols"])
+	}
+	if len(node.children) != 1 || node.children[0].op != renderOp {
+		t.Fatalf("Expected the SELECT plan as the only child, got %v", node.children)
+	}
+
+	output := FormatPlan(node)
+	for _, expected := range []string{"• export", "│ not null columns: 1", "    └── • scan"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestDecodeOpaque(t *testing.T) {
+	// CREATE INDEX ON t (b) plans as a single opaque operator. The version
+	// header and the opaque operator byte are the whole gist.
+	gist := newGistBuilder().op(opaqueOp).String()
+	if gist != "Ais=" {
+		t.Fatalf("Expected gist Ais=, got %s", gist)
+	}
+
+	node := mustDecode(t, gist)
+	if node.op != opaqueOp || len(node.children) != 0 {
+		t.Fatalf("Expected an opaque leaf, got %s with %d children", opName(node.op), len(node.children))
+	}
+	if output := FormatPlan(node); output != "  • opaque\n" {
+		t.Errorf("Expected a bare opaque label, got:\n%s", output)
+	}
+
+	// An opaque statement inside a larger plan must not consume the bytes
+	// of the operators that follow it.
+	gist = newGistBuilder().op(opaqueOp).op(renderOp).int(1).String()
+	node = mustDecode(t, gist)
+	if node.op != renderOp || len(node.children) != 1 || node.children[0].op != opaqueOp {
+		t.Errorf("Expected render over opaque, got %s", Summarize(node))
+	}
+}
+
+func TestDecodeShowTraceAndCompletions(t *testing.T) {
+	// SHOW COMPACT TRACE FOR SESSION, rendered as a single column.
+	gist := newGistBuilder().op(showTraceOp).bool(true).op(renderOp).int(1).String()
+	node := mustDecode(t, gist)
+	if node.op != renderOp || len(node.children) != 1 {
+		t.Fatalf("Expected render over show trace, got %s", Summarize(node))
+	}
+	trace := node.children[0]
+	if trace.op != showTraceOp || len(trace.children) != 0 {
+		t.Fatalf("Expected a show trace leaf, got %s with %d children", opName(trace.op), len(trace.children))
+	}
+	if trace.args["compact"] != true {
+		t.Errorf("Expected a compact trace, got %v", trace.args)
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "• show trace\n        compact\n") {
+		t.Errorf("Expected the compact flag in the output, got:\n%s", output)
+	}
+
+	// SHOW COMPLETIONS AT OFFSET 1 FOR 'SELECT'. Nothing follows the
+	// operator byte, so the render after it decodes intact.
+	gist = newGistBuilder().op(showCompletionsOp).op(renderOp).int(5).String()
+	node = mustDecode(t, gist)
+	if node.op != renderOp || node.args["columns"] != 5 {
+		t.Fatalf("Expected a render of 5 columns, got %s %v", opName(node.op), node.args)
+	}
+	if len(node.children) != 1 || node.children[0].op != showCompletionsOp || len(node.children[0].children) != 0 {
+		t.Errorf("Expected a show completions leaf under the render, got %s", Summarize(node))
+	}
+}
+
+func TestDecodeCreateViewAndTrigger(t *testing.T) {
+	// CREATE VIEW v AS SELECT a, b FROM t, created in schema 105. The
+	// view's query is not planned, so the scan of t is not in the gist.
+	gist := newGistBuilder().op(createViewOp).int(105).int(2).String()
+	node := mustDecode(t, gist)
+	if node.op != createViewOp || len(node.children) != 0 {
+		t.Fatalf("Expected a create view leaf, got %s with %d children", opName(node.op), len(node.children))
+	}
+	if node.args["schema_id"] != int64(105) || node.args["columns"] != 2 {
+		t.Errorf("Expected schema 105 and 2 columns, got %v", node.args)
+	}
+	expected := "  • create view\n    schema: 105\n    columns: 2\n"
+	if output := FormatPlan(node); output != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	// CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW EXECUTE FUNCTION f()
+	// encodes no body; the table and function are only named in the SQL.
+	gist = newGistBuilder().op(createTriggerOp).String()
+	node = mustDecode(t, gist)
+	if node.op != createTriggerOp || len(node.children) != 0 {
+		t.Errorf("Expected a create trigger leaf, got %s with %d children", opName(node.op), len(node.children))
+	}
+	if output := FormatPlan(node); output != "  • create trigger\n" {
+		t.Errorf("Expected a bare create trigger label, got:\n%s", output)
+	}
+}
+
+func TestDecodeCall(t *testing.T) {
+	// CALL p(1, 2) is a single call operator.
+	node := mustDecode(t, newGistBuilder().op(callOp).String())
+	if node.op != callOp || len(node.children) != 0 {
+		t.Fatalf("Expected a call leaf, got %s with %d children", opName(node.op), len(node.children))
+	}
+
+	// A call must not pop an operator decoded before it. Neither operator
+	// consumes the other, so the stack is left unbalanced and the call is
+	// the most recent subtree.
+	gist := newGistBuilder().op(valuesOp).int(1).int(1).op(callOp).String()
+	node, err := DecodePlanGistPartial(gist, nil, nil)
+	if !errors.Is(err, ErrStackImbalance) {
+		t.Fatalf("Expected ErrStackImbalance, got %v", err)
+	}
+	if node.op != callOp || len(node.children) != 0 {
+		t.Errorf("Expected the call to leave the values on the stack, got %s with %d children",
+			opName(node.op), len(node.children))
+	}
+}
+
+func TestDecodeCreateFunction(t *testing.T) {
+	// CREATE FUNCTION f() RETURNS INT AS 'SELECT 1' in schema 105, decoded
+	// after an unrelated values operator to catch a phantom pop.
+	gist := newGistBuilder().op(valuesOp).int(1).int(1).op(createFunctionOp).int(105).String()
+
+	node, err := DecodePlanGistPartial(gist, nil, nil)
+	if !errors.Is(err, ErrStackImbalance) {
+		t.Fatalf("Expected ErrStackImbalance for the unconsumed values, got %v", err)
+	}
+	if node.op != createFunctionOp || len(node.children) != 0 {
+		t.Fatalf("Expected a create function leaf, got %s with %d children", opName(node.op), len(node.children))
+	}
+	if node.args["schema_id"] != int64(105) {
+		t.Errorf("Expected schema 105, got %v", node.args["schema_id"])
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "• create function\n    schema: 105") {
+		t.Errorf("Expected the schema in the output, got:\n%s", output)
+	}
+}
+
+func TestDecodeControlOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		gist     string
+		op       execOperator
+		ifExists bool
+	}{
+		{
+			// PAUSE JOB 123
+			name: "pause job",
+			gist: newGistBuilder().op(valuesOp).int(1).int(1).op(controlJobsOp).String(),
+			op:   controlJobsOp,
+		},
+		{
+			// CANCEL QUERY IF EXISTS '...'
+			name:     "cancel query",
+			gist:     newGistBuilder().op(valuesOp).int(1).int(1).op(cancelQueriesOp).bool(true).String(),
+			op:       cancelQueriesOp,
+			ifExists: true,
+		},
+		{
+			// CANCEL SESSIONS (SELECT session_id FROM [SHOW SESSIONS] ...)
+			name: "cancel sessions",
+			gist: newGistBuilder().
+				scan(112, 1, 1, 0, 0).
+				op(renderOp).int(1).
+				op(cancelSessionsOp).bool(false).
+				String(),
+			op: cancelSessionsOp,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := mustDecode(t, tt.gist)
+			if node.op != tt.op {
+				t.Fatalf("Expected %s, got %s", opName(tt.op), opName(node.op))
+			}
+			if len(node.children) != 1 {
+				t.Fatalf("Expected the ID-producing input as the only child, got %d children", len(node.children))
+			}
+			if _, ok := node.args["if_exists"]; ok != tt.ifExists {
+				t.Errorf("Expected if_exists to be %v, got %v", tt.ifExists, node.args)
+			}
+		})
+	}
+}
+
+func TestDecodeAlterTableSplit(t *testing.T) {
+	// ALTER TABLE t SPLIT AT VALUES (10), (20)
+	gist := newGistBuilder().
+		op(valuesOp).int(2).int(1).
+		op(alterTableSplitOp).int(112).int(1).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != alterTableSplitOp {
+		t.Fatalf("Expected split, got %s", opName(node.op))
+	}
+	if node.args["table_id"] != int64(112) || node.args["index_id"] != int64(1) {
+		t.Errorf("Expected index 112@1, got %v", node.args)
+	}
+	if len(node.children) != 1 || node.children[0].op != valuesOp {
+		t.Fatalf("Expected the split points as the only child, got %v", node.children)
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "│ index: 112@1") {
+		t.Errorf("Expected the index in the output, got:\n%s", output)
+	}
+}
+
+func TestDecodeAlterTableUnsplitAll(t *testing.T) {
+	// ALTER INDEX t@t_b_idx UNSPLIT ALL, decoded after an unrelated values
+	// operator to catch a phantom pop.
+	gist := newGistBuilder().
+		op(valuesOp).int(1).int(1).
+		op(alterTableUnsplitAllOp).int(112).int(2).
+		String()
+
+	node, err := DecodePlanGistPartial(gist, nil, nil)
+	if !errors.Is(err, ErrStackImbalance) {
+		t.Fatalf("Expected ErrStackImbalance for the unconsumed values, got %v", err)
+	}
+	if node.op != alterTableUnsplitAllOp || len(node.children) != 0 {
+		t.Fatalf("Expected an unsplit all leaf, got %s with %d children", opName(node.op), len(node.children))
+	}
+	if node.args["table_id"] != int64(112) || node.args["index_id"] != int64(2) {
+		t.Errorf("Expected index 112@2, got %v", node.args)
+	}
+}
+
+func TestDecodeSequenceSelect(t *testing.T) {
+	// SELECT * FROM s, for a sequence with descriptor ID 120.
+	gist := newGistBuilder().op(sequenceSelectOp).int(120).String()
+
+	node := mustDecode(t, gist)
+	if node.op != sequenceSelectOp || len(node.children) != 0 {
+		t.Fatalf("Expected a sequence select leaf, got %s with %d children", opName(node.op), len(node.children))
+	}
+	if node.args["sequence_id"] != int64(120) {
+		t.Errorf("Expected sequence 120, got %v", node.args["sequence_id"])
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "  sequence: 120") {
+		t.Errorf("Expected the sequence in the output, got:\n%s", output)
+	}
+
+	node, err := DecodePlanGist(gist, func(id int64) string { return "s" }, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "  sequence: s") {
+		t.Errorf("Expected the sequence name in the output, got:\n%s", output)
+	}
+}
+
+func TestDecodeSaveTable(t *testing.T) {
+	// A statement bundle saving the output of a filtered scan.
+	gist := newGistBuilder().
+		scan(112, 1, 1, 0, 0).
+		op(filterOp).
+		op(saveTableOp).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != saveTableOp {
+		t.Fatalf("Expected save table, got %s", opName(node.op))
+	}
+	if len(node.children) != 1 || node.children[0].op != filterOp {
+		t.Fatalf("Expected the saved plan as the only child, got %v", node.children)
+	}
+	if got := Summarize(node); got != "scan(112)→filter→save table" {
+		t.Errorf("Expected scan(112)→filter→save table, got %s", got)
+	}
+}
+
+func TestDecodeExplain(t *testing.T) {
+	// EXPLAIN SELECT * FROM t WHERE a = 1 and EXPLAIN (OPT) of the same
+	// query. The explained plan is not part of the gist, so each decodes to
+	// a single explain operator.
+	for _, op := range []execOperator{explainOp, explainOptOp} {
+		node := mustDecode(t, newGistBuilder().op(op).String())
+		if node.op != op || len(node.children) != 0 {
+			t.Errorf("Expected a lone %s, got %s with %d children", opName(op), opName(node.op), len(node.children))
+		}
+	}
+
+	// EXPLAIN (OPT, VERBOSE) encodes no mode: a byte following the operator
+	// is the next operator, not a flag.
+	node := mustDecode(t, newGistBuilder().op(explainOptOp).op(renderOp).int(1).String())
+	if node.op != renderOp || len(node.children) != 1 || node.children[0].op != explainOptOp {
+		t.Fatalf("Expected a render over explain (opt), got %s", Summarize(node))
+	}
+	if _, ok := node.children[0].args["explain_mode"]; ok {
+		t.Errorf("Expected no explain mode, got %v", node.children[0].args["explain_mode"])
+	}
+
+	// Having no encoded input, an explain must not pop a preceding subtree.
+	gist := newGistBuilder().scan(112, 1, 1, 0, 0).op(explainOp).String()
+	node, err := DecodePlanGistPartial(gist, nil, nil)
+	if !errors.Is(err, ErrStackImbalance) {
+		t.Fatalf("Expected ErrStackImbalance for the unconsumed scan, got %v", err)
+	}
+	if node.op != explainOp || len(node.children) != 0 {
+		t.Errorf("Expected the explain to leave the scan on the stack, got %s with %d children",
+			opName(node.op), len(node.children))
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	// An insert with two foreign key checks.
+	gist := newGistBuilder().
+		op(valuesOp).int(1).int(2).
+		op(bufferOp).int(1).
+		op(insertOp).int(113).intSet(0, 1).emptyIntSet().emptyIntSet().bool(false).
+		op(scanBufferOp).int(1).
+		op(lookupJoinOp).byte(5).int(112).int(1).int(1).bool(true).
+		op(errorIfRowsOp).
+		op(scanBufferOp).int(1).
+		op(lookupJoinOp).byte(5).int(114).int(1).int(1).bool(true).
+		op(errorIfRowsOp).
+		String()
+
+	root, checks := mustDecode(t, gist).Unwrap()
+	if root.op != insertOp {
+		t.Errorf("Expected the insert as the main plan, got %s", opName(root.op))
+	}
+	if len(checks) != 2 {
+		t.Fatalf("Expected 2 checks, got %d", len(checks))
+	}
+	for i, table := range []int64{112, 114} {
+		if checks[i].op != errorIfRowsOp {
+			t.Errorf("Expected check %d to be error if rows, got %s", i, opName(checks[i].op))
+		}
+		if join := checks[i].children[0]; join.args["table"] != fmt.Sprint(table) {
+			t.Errorf("Expected check %d to look up into %d, got %v", i, table, join.args["table"])
+		}
+	}
+
+	// A plan without checks is returned as is.
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+	root, checks = node.Unwrap()
+	if root != node || checks != nil {
+		t.Errorf("Expected (node, nil) for a plan without checks, got (%v, %v)", root, checks)
+	}
+
+	var nilNode *Node
+	if root, checks := nilNode.Unwrap(); root != nil || checks != nil {
+		t.Errorf("Expected (nil, nil) for a nil node, got (%v, %v)", root, checks)
+	}
+}
+
+func TestDecodeUpsertColumns(t *testing.T) {
+	// INSERT INTO t (k, a, b) VALUES (1, 2, 3)
+	//   ON CONFLICT (k) DO UPDATE SET a = excluded.a
+	// The upsert inserts 3 columns, fetches the 3 existing ones to detect
+	// the conflict, updates 1, and checks 1 constraint.
+	gist := newGistBuilder().
+		op(valuesOp).int(1).int(3).
+		op(lookupJoinOp).byte(1).int(112).int(1).int(1).bool(true).
+		op(upsertOp).int(112).intSet(0, 1, 2).intSet(3, 4, 5).intSet(4).emptyIntSet().intSet(0).bool(true).
+		String()
+
+	node := mustDecode(t, gist)
+	if node.op != upsertOp {
+		t.Fatalf("Expected upsert, got %s", opName(node.op))
+	}
+	expected := map[string]int{"insert_cols": 3, "fetch_cols": 3, "update_cols": 1, "return_cols": 0, "check_cols": 1}
+	for arg, count := range expected {
+		if node.args[arg] != count {
+			t.Errorf("Expected %s to be %d, got %v", arg, count, node.args[arg])
+		}
+	}
+
+	output := FormatPlan(node)
+	for _, line := range []string{"│ insert columns: 3\n", "│ fetch columns: 3\n", "│ update columns: 1\n", "│ check columns: 1\n"} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+	if strings.Contains(output, "return columns") {
+		t.Errorf("Expected no return columns line without RETURNING, got:\n%s", output)
+	}
+}
+
+func TestDecodeMutationColumns(t *testing.T) {
+	// INSERT INTO t (a, b, c) VALUES (1, 2, 3) RETURNING a, b
+	insert := newGistBuilder().
+		op(valuesOp).int(1).int(3).
+		op(insertOp).int(112).intSet(0, 1, 2).intSet(0, 1).emptyIntSet().bool(true).
+		String()
+	node := mustDecode(t, insert)
+	for arg, count := range map[string]int{"insert_cols": 3, "return_cols": 2, "check_cols": 0} {
+		if node.args[arg] != count {
+			t.Errorf("Expected %s to be %d, got %v", arg, count, node.args[arg])
+		}
+	}
+	output := FormatPlan(node)
+	for _, line := range []string{"│ insert columns: 3\n", "│ return columns: 2\n"} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+
+	// DELETE FROM t WHERE a = 1 RETURNING a
+	del := newGistBuilder().
+		scan(112, 1, 1, 0, 0).
+		op(deleteOp).int(112).intSet(0, 1).intSet(0).bool(true).
+		String()
+	node = mustDecode(t, del)
+	for arg, count := range map[string]int{"fetch_cols": 2, "return_cols": 1} {
+		if node.args[arg] != count {
+			t.Errorf("Expected %s to be %d, got %v", arg, count, node.args[arg])
+		}
+	}
+}
+
+func TestDecodeMutationReturning(t *testing.T) {
+	// INSERT INTO t (a) VALUES (1) RETURNING id, against the same insert
+	// without RETURNING.
+	returning := newGistBuilder().
+		op(valuesOp).int(1).int(1).
+		op(insertOp).int(112).intSet(0, 1).intSet(0).emptyIntSet().bool(true).
+		String()
+	plain := newGistBuilder().
+		op(valuesOp).int(1).int(1).
+		op(insertOp).int(112).intSet(0, 1).emptyIntSet().emptyIntSet().bool(true).
+		String()
+
+	node := mustDecode(t, returning)
+	if node.args["has_returning"] != true {
+		t.Errorf("Expected has_returning for INSERT ... RETURNING, got %v", node.args["has_returning"])
+	}
+	if output := FormatPlan(node); !strings.Contains(output, "│ returning\n") {
+		t.Errorf("Expected the returning line, got:\n%s", output)
+	}
+
+	node = mustDecode(t, plain)
+	if node.args["has_returning"] != false {
+		t.Errorf("Expected no has_returning for a plain INSERT, got %v", node.args["has_returning"])
+	}
+	if output := FormatPlan(node); strings.Contains(output, "returning") {
+		t.Errorf("Expected no returning line, got:\n%s", output)
+	}
+}
+
+func TestDecodeMutationAutoCommit(t *testing.T) {
+	// INSERT INTO t (a) VALUES (1) in an implicit transaction commits with
+	// the insert; inside BEGIN ... COMMIT it doesn't.
+	insert := func(autoCommit bool) string {
+		return newGistBuilder().
+			op(valuesOp).int(1).int(1).
+			op(insertOp).int(112).intSet(0, 1).emptyIntSet().emptyIntSet().bool(autoCommit).
+			String()
+	}
+
+	node := mustDecode(t, insert(true))
+	if node.args["auto_commit"] != true {
+		t.Errorf("Expected auto_commit for an implicit transaction, got %v", node.args["auto_commit"])
+	}
+	for _, opts := range []FormatOptions{{}, {CockroachCompat: true}} {
+		if output := FormatPlanWithOptions(node, opts); !strings.Contains(output, "│ auto commit\n") {
+			t.Errorf("Expected the auto commit line, got:\n%s", output)
+		}
+	}
+
+	node = mustDecode(t, insert(false))
+	if node.args["auto_commit"] != false {
+		t.Errorf("Expected no auto_commit in an explicit transaction, got %v", node.args["auto_commit"])
+	}
+	if output := FormatPlan(node); strings.Contains(output, "auto commit") {
+		t.Errorf("Expected no auto commit line, got:\n%s", output)
+	}
+}
+
+func TestDecodeIntSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      *gistBuilder
+		expected []int
+	}{
+		{
+			name:     "empty bitmap",
+			set:      (&gistBuilder{}).uvarint(0).uvarint(0),
+			expected: nil,
+		},
+		{
+			// 0b100101: members 0, 2, and 5.
+			name:     "bitmap",
+			set:      (&gistBuilder{}).uvarint(0).uvarint(0x25),
+			expected: []int{0, 2, 5},
+		},
+		{
+			name:     "highest bitmap member",
+			set:      (&gistBuilder{}).uvarint(0).uvarint(1 << 63),
+			expected: []int{63},
+		},
+		{
+			// A set with a member past 63 is written as its length
+			// followed by each member.
+			name:     "members",
+			set:      (&gistBuilder{}).uvarint(5).uvarint(1).uvarint(2).uvarint(3).uvarint(70).uvarint(71),
+			expected: []int{1, 2, 3, 70, 71},
+		},
+		{
+			name:     "single large member",
+			set:      (&gistBuilder{}).uvarint(1).uvarint(64),
+			expected: []int{64},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d planGistDecoder
+			d.buf.Reset(tt.set.buf.Bytes())
+			if got := d.decodeIntSet(); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected members %v, got %v", tt.expected, got)
+			}
+			if d.buf.Len() != 0 {
+				t.Errorf("Expected the whole set to be consumed, %d bytes left", d.buf.Len())
+			}
+		})
+	}
+}
+
+func TestDecodeIntSetTooLarge(t *testing.T) {
+	// A scan whose needed columns claim 2^40 members.
+	b := newGistBuilder().op(scanOp).int(112).int(1)
+	b.uvarint(1 << 40).uvarint(0)
+	gist := b.int(0).int(0).int(0).String()
+
+	_, err := DecodePlanGist(gist, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "more than 65536") {
+		t.Errorf("Expected an oversized intset error, got %v", err)
+	}
+}
+
+func TestFormatPlanNilNode(t *testing.T) {
+	output := FormatPlan(nil)
+	if output != "" {
+		t.Errorf("Expected empty string for nil node, got: %s", output)
+	}
+}
+
+func BenchmarkDecodePlanGist(b *testing.B) {
+	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := DecodePlanGist(gist, nil, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodePlanGistPooled(b *testing.B) {
+	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := DecodePlanGist(gist, nil, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodePlanGistUnpooled decodes with a fresh decoder per gist, as
+// DecodePlanGist did before decoders were pooled, for comparing allocs/op.
+func BenchmarkDecodePlanGistUnpooled(b *testing.B) {
+	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d := planGistDecoder{config: defaultDecodeConfig()}
+		_, err := d.decodeGist(gist)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecoderReuse decodes with a single Decoder, which should allocate
+// only the plan nodes themselves.
+func BenchmarkDecoderReuse(b *testing.B) {
+	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+	dec := NewDecoder(nil, nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := dec.Decode(gist)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFormatPlan(b *testing.B) {
+	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+	node, _ := DecodePlanGist(gist, nil, nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = FormatPlan(node)
+	}
+}
+
+func FuzzDecodePlanGist(f *testing.F) {
+	for _, seed := range []string{
+		"AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM",
+		newGistBuilder().scan(112, 1, 1, 0, 0).op(renderOp).String(),
+		newGistBuilder().op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).String(),
+		newGistBuilder().op(scanOp).int(112).int(1).uvarint(1 << 40).String(),
+		"",
+		"AA==",
+		"not-valid-base64!",
+	} {
+		f.Add(seed)
+	}
+
+	// decodePlan re-panics anything but the decoder's own failures, so a
+	// panic reaching the fuzzer is a decoder bug.
+	f.Fuzz(func(t *testing.T, gist string) {
+		node, err := DecodePlanGist(gist, nil, nil)
+		if err != nil {
+			var decodeErr *DecodeError
+			var corrupt base64.CorruptInputError
+			switch {
+			case errors.As(err, &decodeErr), errors.As(err, &corrupt),
+				errors.Is(err, ErrStackUnderflow), errors.Is(err, ErrStackImbalance), errors.Is(err, ErrUnknownOperator),
+				errors.Is(err, ErrUnsupportedVersion), errors.Is(err, ErrMaxNodesExceeded):
+			default:
+				t.Fatalf("DecodePlanGist(%q) returned an error of unexpected type %T: %v", gist, err, err)
+			}
+			return
+		}
+		// Formatting a decoded plan must not panic either.
+		_ = FormatPlan(node)
+	})
+}
+
+func TestDecodeReader(t *testing.T) {
+	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+	expected := FormatPlan(mustDecode(t, gist))
+
+	node, err := DecodeReader(strings.NewReader(gist+"\n"), nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output := FormatPlan(node); output != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(gist)
+	node, err = DecodeRawReader(bytes.NewReader(raw), nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output := FormatPlan(node); output != expected {
+		t.Errorf("Expected the raw gist to decode the same, got:\n%s", output)
+	}
+
+	if _, err := DecodeReader(strings.NewReader("not-valid-base64!"), nil, nil); err == nil {
+		t.Error("Expected error for invalid base64")
 	}
 }
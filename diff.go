@@ -0,0 +1,163 @@
+package gistdecoder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// DiffKind identifies how two aligned plan nodes differ.
+type DiffKind int
+
+const (
+	// DiffOperatorChanged means the nodes at the same position have different
+	// operators, e.g. a merge join became a hash join.
+	DiffOperatorChanged DiffKind = iota
+	// DiffNodeAdded means the new plan has a node with no counterpart in the
+	// old plan.
+	DiffNodeAdded
+	// DiffNodeRemoved means the old plan has a node with no counterpart in the
+	// new plan.
+	DiffNodeRemoved
+	// DiffArgChanged means the nodes have the same operator but an argument
+	// differs, e.g. a constrained scan became a full scan.
+	DiffArgChanged
+)
+
+// String returns a human-readable name for the diff kind.
+func (k DiffKind) String() string {
+	switch k {
+	case DiffOperatorChanged:
+		return "operator changed"
+	case DiffNodeAdded:
+		return "node added"
+	case DiffNodeRemoved:
+		return "node removed"
+	case DiffArgChanged:
+		return "arg changed"
+	}
+	return fmt.Sprintf("diff kind %d", int(k))
+}
+
+// PlanDiff describes a single difference between two plans.
+type PlanDiff struct {
+	// Path locates the node as child indexes from the root, e.g. "/0/1" is the
+	// second child of the root's first child. The root itself is "/".
+	Path string
+	// Kind is the kind of change.
+	Kind DiffKind
+	// Arg is the argument name for DiffArgChanged and empty otherwise.
+	Arg string
+	// Old and New are the operator names (or argument values for
+	// DiffArgChanged) in each plan. The missing side of an added or removed
+	// node is empty.
+	Old, New string
+}
+
+// DiffPlans compares two plan trees structurally and returns their
+// differences. Nodes are aligned by position: the children of two aligned
+// nodes are compared pairwise in order. When aligned nodes have different
+// operators only the operator change is reported for them (not their
+// arguments), and their children are still compared.
+func DiffPlans(a, b *Node) []PlanDiff {
+	var diffs []PlanDiff
+	diffNodes(a, b, "/", &diffs)
+	return diffs
+}
+
+func diffNodes(a, b *Node, path string, diffs *[]PlanDiff) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		*diffs = append(*diffs, PlanDiff{Path: path, Kind: DiffNodeAdded, New: planOpName(b)})
+		return
+	case b == nil:
+		*diffs = append(*diffs, PlanDiff{Path: path, Kind: DiffNodeRemoved, Old: planOpName(a)})
+		return
+	}
+
+	if a.op != b.op {
+		*diffs = append(*diffs, PlanDiff{Path: path, Kind: DiffOperatorChanged, Old: planOpName(a), New: planOpName(b)})
+	} else {
+		diffArgs(a, b, path, diffs)
+	}
+
+	for i := 0; i < len(a.children) || i < len(b.children); i++ {
+		var childA, childB *Node
+		if i < len(a.children) {
+			childA = a.children[i]
+		}
+		if i < len(b.children) {
+			childB = b.children[i]
+		}
+		diffNodes(childA, childB, childPath(path, i), diffs)
+	}
+}
+
+// diffArgs reports the arguments that differ between a and b, in key order.
+// Values are compared by their default string formatting.
+func diffArgs(a, b *Node, path string, diffs *[]PlanDiff) {
+	keys := make(map[string]struct{}, len(a.args)+len(b.args))
+	for k := range a.args {
+		keys[k] = struct{}{}
+	}
+	for k := range b.args {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		oldVal, oldOK := a.args[k]
+		newVal, newOK := b.args[k]
+		var oldStr, newStr string
+		if oldOK {
+			oldStr = fmt.Sprint(oldVal)
+		}
+		if newOK {
+			newStr = fmt.Sprint(newVal)
+		}
+		if oldOK != newOK || oldStr != newStr {
+			*diffs = append(*diffs, PlanDiff{Path: path, Kind: DiffArgChanged, Arg: k, Old: oldStr, New: newStr})
+		}
+	}
+}
+
+// Equal reports whether the plans rooted at a and b are structurally
+// identical: the same operators with the same arguments, and equal children
+// in the same order. Two nil plans are equal, and a nil plan equals no other.
+//
+// Argument values are compared with reflect.DeepEqual, so unlike DiffPlans,
+// which compares their string formatting, values of different types never
+// match: an int 1 is not equal to an int64 1 or the string "1". A nil args
+// map or children slice is equal to an empty one.
+func Equal(a, b *Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.op != b.op || len(a.args) != len(b.args) || len(a.children) != len(b.children) {
+		return false
+	}
+	for k, v := range a.args {
+		if w, ok := b.args[k]; !ok || !reflect.DeepEqual(v, w) {
+			return false
+		}
+	}
+	for i := range a.children {
+		if !Equal(a.children[i], b.children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func childPath(path string, i int) string {
+	if path == "/" {
+		return fmt.Sprintf("/%d", i)
+	}
+	return fmt.Sprintf("%s/%d", path, i)
+}
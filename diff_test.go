@@ -0,0 +1,128 @@
+package gistdecoder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffPlansOperatorChanged(t *testing.T) {
+	hashJoin := mustDecode(t, hashJoinGist(112, 113, 0))
+	mergeJoin := mustDecode(t, newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(113, 2, 1, 0, 0).
+		op(mergeJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		String())
+
+	diffs := DiffPlans(hashJoin, mergeJoin)
+	expected := []PlanDiff{
+		{Path: "/", Kind: DiffOperatorChanged, Old: "hash join", New: "merge join"},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diffs)
+	}
+}
+
+func TestDiffPlansArgChanged(t *testing.T) {
+	constrained := mustDecode(t, newGistBuilder().scan(112, 1, 1, 0, 0).op(filterOp).String())
+	full := mustDecode(t, newGistBuilder().scan(112, 1, 0, 0, 0).op(filterOp).String())
+
+	diffs := DiffPlans(constrained, full)
+	expected := []PlanDiff{
+		{Path: "/0", Kind: DiffArgChanged, Arg: "full_scan", Old: "false", New: "true"},
+		{Path: "/0", Kind: DiffArgChanged, Arg: "index_constraint", Old: "true", New: ""},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diffs)
+	}
+}
+
+func TestDiffPlansNodeAddedAndRemoved(t *testing.T) {
+	scan := mustDecode(t, newGistBuilder().scan(112, 1, 1, 0, 0).String())
+	filtered := mustDecode(t, newGistBuilder().scan(112, 1, 1, 0, 0).op(filterOp).String())
+
+	diffs := DiffPlans(filtered, scan)
+	if len(diffs) != 2 || diffs[0].Kind != DiffOperatorChanged || diffs[1].Kind != DiffNodeRemoved || diffs[1].Path != "/0" {
+		t.Errorf("Expected operator change at root and removed child, got %+v", diffs)
+	}
+
+	diffs = DiffPlans(scan, filtered)
+	if len(diffs) != 2 || diffs[1].Kind != DiffNodeAdded || diffs[1].New != "scan" {
+		t.Errorf("Expected added scan child, got %+v", diffs)
+	}
+}
+
+func TestDiffPlansIdentical(t *testing.T) {
+	a := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+	b := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+
+	if diffs := DiffPlans(a, b); len(diffs) != 0 {
+		t.Errorf("Expected no differences, got %+v", diffs)
+	}
+	if diffs := DiffPlans(nil, nil); len(diffs) != 0 {
+		t.Errorf("Expected no differences for nil plans, got %+v", diffs)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	const gist = "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+	a := mustDecode(t, gist)
+	if !Equal(a, mustDecode(t, gist)) {
+		t.Error("Expected two decodes of the same gist to be equal")
+	}
+	if !Equal(a, a.Clone()) {
+		t.Error("Expected a plan to equal its clone")
+	}
+	if !Equal(nil, nil) {
+		t.Error("Expected nil plans to be equal")
+	}
+	if Equal(a, nil) || Equal(nil, a) {
+		t.Error("Expected a plan not to equal nil")
+	}
+	if !Equal(&Node{op: scanOp}, &Node{op: scanOp, args: map[string]interface{}{}, children: []*Node{}}) {
+		t.Error("Expected nil and empty args and children to be equal")
+	}
+}
+
+func TestEqualArgs(t *testing.T) {
+	constrained := mustDecode(t, newGistBuilder().scan(112, 1, 1, 0, 0).String())
+	full := mustDecode(t, newGistBuilder().scan(112, 1, 0, 0, 0).String())
+	if Equal(constrained, full) || Equal(full, constrained) {
+		t.Error("Expected scans with different spans not to be equal")
+	}
+
+	// Values of different types differ even when they print the same.
+	b := constrained.Clone()
+	b.args["table_id"] = int(112)
+	if Equal(constrained, b) {
+		t.Errorf("Expected table_id %T not to equal %T", constrained.args["table_id"], b.args["table_id"])
+	}
+
+	b = constrained.Clone()
+	b.args["extra"] = true
+	if Equal(constrained, b) || Equal(b, constrained) {
+		t.Error("Expected an extra argument to make the plans differ")
+	}
+}
+
+func TestEqualStructure(t *testing.T) {
+	scan := mustDecode(t, newGistBuilder().scan(112, 1, 1, 0, 0).String())
+	filtered := mustDecode(t, newGistBuilder().scan(112, 1, 1, 0, 0).op(filterOp).String())
+	if Equal(scan, filtered) || Equal(filtered, scan) {
+		t.Error("Expected plans with different operators not to be equal")
+	}
+
+	join := mustDecode(t, newGistBuilder().
+		scan(112, 1, 1, 0, 0).scan(113, 1, 1, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).String())
+	swapped := join.Clone()
+	swapped.children[0], swapped.children[1] = swapped.children[1], swapped.children[0]
+	if Equal(join, swapped) {
+		t.Error("Expected children in a different order not to be equal")
+	}
+
+	nilChild := join.Clone()
+	nilChild.children[1] = nil
+	if Equal(join, nilChild) || Equal(nilChild, join) {
+		t.Error("Expected a nil child not to equal a scan")
+	}
+}
@@ -0,0 +1,69 @@
+package gistdecoder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatPlanDOT formats a decoded plan tree as a Graphviz digraph.
+// Every plan node becomes a graph node labeled with its operator name and
+// key arguments (such as table and index), with edges pointing from each
+// parent to its children. Node IDs are assigned in pre-order traversal.
+//
+// Example:
+//
+//	node, _ := DecodePlanGist(gist, nil, nil)
+//	fmt.Print(FormatPlanDOT(node))
+func FormatPlanDOT(n *Node) string {
+	if n == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("digraph plan {\n")
+	sb.WriteString("  node [shape=box];\n")
+
+	nextID := 0
+	var visit func(n *Node) int
+	visit = func(n *Node) int {
+		id := nextID
+		nextID++
+		sb.WriteString(fmt.Sprintf("  n%d [label=\"%s\"];\n", id, dotEscape(dotLabel(n))))
+		for _, child := range n.children {
+			if child == nil {
+				continue
+			}
+			childID := visit(child)
+			sb.WriteString(fmt.Sprintf("  n%d -> n%d;\n", id, childID))
+		}
+		return id
+	}
+	visit(n)
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// dotLabel builds the label lines for a node: the operator name followed by
+// the table (and index, when known).
+func dotLabel(n *Node) string {
+	label := planOpName(n)
+	if table, ok := n.args["table"]; ok {
+		if index, ok := n.args["index"]; ok {
+			label += fmt.Sprintf("\n%v@%v", table, index)
+		} else {
+			label += fmt.Sprintf("\n%v", table)
+		}
+	}
+	if jt, ok := n.args["type"]; ok {
+		label += fmt.Sprintf("\ntype: %v", jt)
+	}
+	return label
+}
+
+// dotEscape escapes a label for use inside a double-quoted DOT string.
+func dotEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
@@ -0,0 +1,62 @@
+package gistdecoder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatPlanDOT(t *testing.T) {
+	node, err := DecodePlanGist("AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	output := FormatPlanDOT(node)
+
+	if !strings.HasPrefix(output, "digraph") {
+		t.Errorf("Expected output to start with digraph, got:\n%s", output)
+	}
+
+	expectedNodes := []string{
+		`n0 [label="update\n112"];`,
+		`n1 [label="simple project"];`,
+		`n2 [label="render"];`,
+		`n3 [label="scan\n112@1"];`,
+	}
+	for _, expected := range expectedNodes {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q.\nOutput:\n%s", expected, output)
+		}
+	}
+
+	if edges := strings.Count(output, "->"); edges != 3 {
+		t.Errorf("Expected 3 edges, got %d.\nOutput:\n%s", edges, output)
+	}
+}
+
+func TestFormatPlanDOTChecks(t *testing.T) {
+	output := FormatPlanDOT(mustDecode(t, newGistBuilder().
+		op(valuesOp).int(1).int(2).
+		op(insertOp).int(113).intSet(0, 1).emptyIntSet().emptyIntSet().bool(false).
+		scan(112, 1, 1, 0, 0).
+		op(errorIfRowsOp).
+		String()))
+	if !strings.Contains(output, `n0 [label="root"];`) || strings.Contains(output, "op_0") {
+		t.Errorf("Expected the checks wrapper to be labeled root, got:\n%s", output)
+	}
+}
+
+func TestFormatPlanDOTEscapesLabels(t *testing.T) {
+	node := &Node{op: scanOp, args: map[string]interface{}{"table": `my "table"`, "index": "pkey"}}
+
+	output := FormatPlanDOT(node)
+	if !strings.Contains(output, `scan\nmy \"table\"@pkey`) {
+		t.Errorf("Expected escaped label, got:\n%s", output)
+	}
+}
+
+func TestFormatPlanDOTNilNode(t *testing.T) {
+	if output := FormatPlanDOT(nil); output != "" {
+		t.Errorf("Expected empty string for nil node, got: %s", output)
+	}
+}
@@ -0,0 +1,287 @@
+package gistdecoder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrCannotEncode is returned by EncodePlanGist for plans holding an
+// operator it has no encoding for.
+var ErrCannotEncode = errors.New("cannot encode operator")
+
+// planGistEncoder writes plan nodes in the binary gist format read by
+// planGistDecoder.
+type planGistEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *planGistEncoder) encodeInt(v int) {
+	e.buf.Write(binary.AppendVarint(nil, int64(v)))
+}
+
+func (e *planGistEncoder) encodeUvarint(v uint64) {
+	e.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (e *planGistEncoder) encodeByte(v byte) {
+	e.buf.WriteByte(v)
+}
+
+func (e *planGistEncoder) encodeBool(v bool) {
+	if v {
+		e.encodeByte(1)
+	} else {
+		e.encodeByte(0)
+	}
+}
+
+// encodeIntSet encodes an intset of size members. Decoding only keeps the
+// number of members, so the set written is the range 0 to size-1.
+func (e *planGistEncoder) encodeIntSet(size int) {
+	if size <= 64 {
+		var bitmap uint64
+		if size > 0 {
+			bitmap = 1<<uint(size-1)<<1 - 1
+		}
+		e.encodeUvarint(0)
+		e.encodeUvarint(bitmap)
+		return
+	}
+	e.encodeUvarint(uint64(size))
+	for m := 0; m < size; m++ {
+		e.encodeUvarint(uint64(m))
+	}
+}
+
+// encodeJoinType encodes a join type name as produced by decodeJoinType.
+func (e *planGistEncoder) encodeJoinType(jt string) error {
+	for i, name := range []string{
+		"inner", "left outer", "right outer", "full outer",
+		"semi", "anti", "intersect all", "except all",
+	} {
+		if jt == name {
+			e.encodeByte(byte(i))
+			return nil
+		}
+	}
+	var code byte
+	if _, err := fmt.Sscanf(jt, "join type %d", &code); err != nil {
+		return fmt.Errorf("unknown join type %q", jt)
+	}
+	e.encodeByte(code)
+	return nil
+}
+
+// intArg returns the integer argument key of n, or 0 if it is absent.
+func intArg(n *Node, key string) int {
+	switch v := n.args[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// boolArg returns the boolean argument key of n, or false if it is absent.
+func boolArg(n *Node, key string) bool {
+	v, _ := n.args[key].(bool)
+	return v
+}
+
+// stringArg returns the string argument key of n, or "" if it is absent.
+func stringArg(n *Node, key string) string {
+	v, _ := n.args[key].(string)
+	return v
+}
+
+// encodeNode encodes the plan rooted at n in post-order, so that each
+// operator follows the inputs the decoder will pop for it.
+func (e *planGistEncoder) encodeNode(n *Node) error {
+	if n == nil {
+		return errors.New("cannot encode a nil node")
+	}
+	for _, child := range n.children {
+		if err := e.encodeNode(child); err != nil {
+			return err
+		}
+	}
+	if isChecksWrapper(n) {
+		// The main plan and its checks follow one another; decoding places
+		// them back under a wrapper.
+		return nil
+	}
+	if n.op == unknownOp {
+		return fmt.Errorf("%w %s", ErrCannotEncode, opName(n.op))
+	}
+
+	e.encodeByte(byte(n.op))
+	switch n.op {
+	case scanOp:
+		info, _ := n.ScanInfo()
+		e.encodeInt(int(info.TableID))
+		e.encodeInt(int(info.IndexID))
+		e.encodeIntSet(info.NeededCols)
+		if info.IndexConstraint {
+			e.encodeInt(1)
+		} else {
+			e.encodeInt(0)
+		}
+		if info.InvertedConstraint {
+			e.encodeInt(1)
+		} else {
+			e.encodeInt(0)
+		}
+		if info.HardLimit {
+			e.encodeInt(1)
+		} else {
+			e.encodeInt(0)
+		}
+
+	case valuesOp:
+		e.encodeInt(intArg(n, "rows"))
+		e.encodeInt(intArg(n, "columns"))
+
+	case filterOp, scalarGroupByOp, unionAllOp, saveTableOp, controlJobsOp,
+		controlSchedulesOp, errorIfRowsOp, windowOp, ordinalityOp, max1RowOp,
+		createTriggerOp, explainOp, explainOptOp, callOp, showCompletionsOp,
+		opaqueOp, invertedFilterOp, distinctOp, sortOp, limitOp, hashSetOpOp,
+		streamingSetOpOp:
+		// Nothing but the operator byte is encoded.
+
+	case simpleProjectOp, serializingProjectOp:
+		e.encodeInt(intArg(n, "columns"))
+
+	case renderOp:
+		e.encodeInt(intArg(n, "columns"))
+
+	case hashJoinOp, mergeJoinOp:
+		if err := e.encodeJoinType(stringArg(n, "type")); err != nil {
+			return err
+		}
+		e.encodeInt(intArg(n, "left_eq_cols"))
+		e.encodeInt(intArg(n, "right_eq_cols"))
+		e.encodeBool(boolArg(n, "left_key"))
+		e.encodeBool(boolArg(n, "right_key"))
+
+	case applyJoinOp:
+		if err := e.encodeJoinType(stringArg(n, "type")); err != nil {
+			return err
+		}
+
+	case groupByOp:
+		e.encodeInt(intArg(n, "group_cols"))
+		// Only whether the grouping columns are ordered is kept.
+		if boolArg(n, "ordered") {
+			e.encodeInt(1)
+		} else {
+			e.encodeInt(0)
+		}
+
+	case topKOp:
+		e.encodeInt(intArg(n, "k"))
+
+	case indexJoinOp:
+		e.encodeInt(intArg(n, "table_id"))
+		e.encodeInt(intArg(n, "key_cols"))
+
+	case lookupJoinOp:
+		if err := e.encodeJoinType(stringArg(n, "type")); err != nil {
+			return err
+		}
+		e.encodeInt(intArg(n, "table_id"))
+		e.encodeInt(intArg(n, "index_id"))
+		e.encodeInt(intArg(n, "equality_cols"))
+		e.encodeBool(boolArg(n, "eq_cols_are_key"))
+
+	case invertedJoinOp:
+		if err := e.encodeJoinType(stringArg(n, "type")); err != nil {
+			return err
+		}
+		e.encodeInt(intArg(n, "table_id"))
+		e.encodeInt(intArg(n, "index_id"))
+		e.encodeInt(0) // prefix equality columns
+
+	case insertOp:
+		e.encodeInt(intArg(n, "table_id"))
+		e.encodeIntSet(intArg(n, "insert_cols"))
+		e.encodeIntSet(intArg(n, "return_cols"))
+		e.encodeIntSet(intArg(n, "check_cols"))
+		e.encodeBool(boolArg(n, "auto_commit"))
+
+	case updateOp:
+		e.encodeInt(intArg(n, "table_id"))
+
+	case deleteOp:
+		e.encodeInt(intArg(n, "table_id"))
+		e.encodeIntSet(intArg(n, "fetch_cols"))
+		e.encodeIntSet(intArg(n, "return_cols"))
+		e.encodeBool(boolArg(n, "auto_commit"))
+
+	case upsertOp:
+		e.encodeInt(intArg(n, "table_id"))
+		e.encodeIntSet(intArg(n, "insert_cols"))
+		e.encodeIntSet(intArg(n, "fetch_cols"))
+		e.encodeIntSet(intArg(n, "update_cols"))
+		e.encodeIntSet(intArg(n, "return_cols"))
+		e.encodeIntSet(intArg(n, "check_cols"))
+		e.encodeBool(boolArg(n, "auto_commit"))
+
+	case createTableOp, createTableAsOp, createFunctionOp:
+		e.encodeInt(intArg(n, "schema_id"))
+
+	case createViewOp:
+		e.encodeInt(intArg(n, "schema_id"))
+		e.encodeInt(intArg(n, "columns"))
+
+	case alterTableSplitOp, alterTableUnsplitOp, alterTableUnsplitAllOp, alterTableRelocateOp:
+		e.encodeInt(intArg(n, "table_id"))
+		e.encodeInt(intArg(n, "index_id"))
+
+	case sequenceSelectOp:
+		e.encodeInt(intArg(n, "sequence_id"))
+
+	case cancelQueriesOp, cancelSessionsOp:
+		e.encodeBool(boolArg(n, "if_exists"))
+
+	case showTraceOp:
+		e.encodeBool(boolArg(n, "compact"))
+
+	case exportOp:
+		e.encodeIntSet(intArg(n, "not_null_cols"))
+
+	case bufferOp, scanBufferOp:
+		e.encodeInt(intArg(n, "buffer_id"))
+
+	case recursiveCTEOp:
+		e.encodeBool(boolArg(n, "deduplicate"))
+
+	default:
+		return fmt.Errorf("%w %s (code %d)", ErrCannotEncode, opName(n.op), byte(n.op))
+	}
+	return nil
+}
+
+// EncodePlanGist encodes a plan tree in the binary gist format and returns
+// it base64-encoded, as the inverse of DecodePlanGist. Table, index, and
+// sequence IDs are taken from the "_id" arguments, so plans decoded with
+// name lookups encode the same as without.
+//
+// Gists decoded by this package keep only the counts of most column lists,
+// so encoding writes placeholder columns of the same size. The result
+// decodes to a plan equal to n, but is not byte-for-byte the gist n was
+// decoded from. Operators the decoder doesn't support can't be encoded and
+// return ErrCannotEncode.
+func EncodePlanGist(n *Node) (string, error) {
+	var e planGistEncoder
+	e.encodeInt(gistVersion)
+	if n != nil {
+		if err := e.encodeNode(n); err != nil {
+			return "", err
+		}
+	}
+	return base64.StdEncoding.EncodeToString(e.buf.Bytes()), nil
+}
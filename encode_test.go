@@ -0,0 +1,100 @@
+package gistdecoder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkRoundTrip encodes node and asserts that the gist decodes back to an
+// equal plan.
+func checkRoundTrip(t *testing.T, node *Node, tableLookup TableLookupFunc, indexLookup IndexLookupFunc) {
+	t.Helper()
+	gist, err := EncodePlanGist(node)
+	if err != nil {
+		t.Fatalf("Failed to encode plan: %v", err)
+	}
+	decoded, err := DecodePlanGist(gist, tableLookup, indexLookup)
+	if err != nil {
+		t.Fatalf("Failed to decode re-encoded gist %s: %v", gist, err)
+	}
+	if !reflect.DeepEqual(decoded, node) {
+		t.Errorf("Expected the re-encoded gist to decode to:\n%s\ngot:\n%s", FormatPlan(node), FormatPlan(decoded))
+	}
+}
+
+func TestEncodePlanGistRoundTrip(t *testing.T) {
+	checkRoundTrip(t, mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"), nil, nil)
+
+	// Every plan in the golden files, which cover joins, mutations, and
+	// constraint checks.
+	for _, dir := range []string{"testdata/format", "testdata/compat"} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.gist"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			t.Run(file, func(t *testing.T) {
+				b, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkRoundTrip(t, mustDecode(t, strings.TrimSpace(string(b))), nil, nil)
+			})
+		}
+	}
+}
+
+func TestEncodePlanGistOperators(t *testing.T) {
+	for name, gist := range map[string]string{
+		"set op": newGistBuilder().scan(112, 1, 0, 0, 0).scan(113, 1, 0, 0, 0).
+			op(streamingSetOpOp).String(),
+		"apply join": newGistBuilder().scan(112, 1, 0, 0, 0).op(applyJoinOp).byte(4).String(),
+		"top-k":      newGistBuilder().scan(112, 1, 0, 0, 0).op(topKOp).int(5).String(),
+		"group by": newGistBuilder().scan(112, 1, 0, 0, 0).op(groupByOp).int(2).int(1).
+			op(distinctOp).String(),
+		"inverted": newGistBuilder().scan(112, 2, 0, 1, 0).op(invertedFilterOp).String(),
+		"upsert": newGistBuilder().op(valuesOp).int(2).int(3).
+			op(upsertOp).int(112).intSet(0, 1, 2).intSet(0, 1).intSet(2).intSet(0).emptyIntSet().bool(true).String(),
+		"wide insert": newGistBuilder().op(valuesOp).int(1).int(70).
+			op(insertOp).int(112).wideIntSet(70).emptyIntSet().emptyIntSet().bool(true).String(),
+		"create view": newGistBuilder().op(createViewOp).int(105).int(2).String(),
+		"show trace":  newGistBuilder().op(showTraceOp).bool(true).op(renderOp).int(1).String(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			checkRoundTrip(t, mustDecode(t, gist), nil, nil)
+		})
+	}
+}
+
+func TestEncodePlanGistWithNames(t *testing.T) {
+	tableLookup := func(id int64) string { return "users" }
+	indexLookup := func(tableID, indexID int64) string { return "users_pkey" }
+	node, err := DecodePlanGist("AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM", tableLookup, indexLookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The IDs, not the resolved names, are encoded.
+	checkRoundTrip(t, node, tableLookup, indexLookup)
+}
+
+func TestEncodePlanGistEmpty(t *testing.T) {
+	gist, err := EncodePlanGist(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if node := mustDecode(t, gist); node != nil {
+		t.Errorf("Expected an empty plan, got %v", node)
+	}
+}
+
+func TestEncodePlanGistUnsupported(t *testing.T) {
+	node := &Node{op: vectorSearchOp, args: map[string]interface{}{}}
+	if _, err := EncodePlanGist(node); !errors.Is(err, ErrCannotEncode) {
+		t.Errorf("Expected ErrCannotEncode, got %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package gistdecoder
+
+// FindAll returns the nodes of the plan rooted at root whose operator is
+// named op, in the pre-order of Walk. Names are those shown by FormatPlan,
+// such as "scan" or "hash join". It returns nil when no node matches.
+func FindAll(root *Node, op string) []*Node {
+	var found []*Node
+	Walk(root, func(n *Node) bool {
+		if opName(n.op) == op {
+			found = append(found, n)
+		}
+		return true
+	})
+	return found
+}
+
+// FindFirst returns the first node of the plan rooted at root, in the
+// pre-order of Walk, whose operator is named op, or nil if there is none.
+func FindFirst(root *Node, op string) *Node {
+	var found *Node
+	Walk(root, func(n *Node) bool {
+		if found == nil && opName(n.op) == op {
+			found = n
+		}
+		return found == nil
+	})
+	return found
+}
@@ -0,0 +1,41 @@
+package gistdecoder
+
+import "testing"
+
+func TestFindAllAndFindFirst(t *testing.T) {
+	// A sort over a hash join of a full scan of 112 and a constrained scan
+	// of 113.
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(113, 1, 1, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		op(sortOp).
+		String()
+	root := mustDecode(t, gist)
+
+	scans := FindAll(root, "scan")
+	if len(scans) != 2 {
+		t.Fatalf("Expected 2 scans, got %d", len(scans))
+	}
+	if scans[0].args["table_id"] != int64(112) || scans[1].args["table_id"] != int64(113) {
+		t.Errorf("Expected the scans of 112 and 113 in order, got %v and %v", scans[0].args["table_id"], scans[1].args["table_id"])
+	}
+
+	join := FindFirst(root, "hash join")
+	if join == nil || join != root.children[0] {
+		t.Errorf("Expected the hash join under the sort, got %v", join)
+	}
+	if first := FindFirst(root, "scan"); first != scans[0] {
+		t.Errorf("Expected the first scan to be the scan of 112, got %v", first)
+	}
+
+	if found := FindAll(root, "lookup join"); found != nil {
+		t.Errorf("Expected no lookup joins, got %v", found)
+	}
+	if found := FindFirst(root, "lookup join"); found != nil {
+		t.Errorf("Expected no lookup join, got %v", found)
+	}
+	if found := FindAll(nil, "scan"); found != nil {
+		t.Errorf("Expected no nodes in a nil plan, got %v", found)
+	}
+}
@@ -0,0 +1,41 @@
+package gistdecoder
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+)
+
+// PlanFingerprint computes a hash of the plan's shape, so that statements
+// whose plans differ only in the tables they touch or the number of spans
+// they read hash to the same value.
+//
+// Exactly these fields contribute to the hash, visiting nodes in pre-order:
+//   - the operator code of every node, including collapsed projections
+//   - the number of children of every node
+//   - the join type of join operators
+//
+// All other arguments, such as table and index IDs or names, span counts,
+// and limits, are ignored. The hash is 64-bit FNV-1a and is stable across
+// releases of this package unless the fields above change. A nil plan hashes
+// to the FNV offset basis.
+func PlanFingerprint(n *Node) uint64 {
+	h := fnv.New64a()
+	fingerprintNode(h, n)
+	return h.Sum64()
+}
+
+func fingerprintNode(h hash.Hash64, n *Node) {
+	if n == nil {
+		return
+	}
+	h.Write([]byte{byte(n.op), byte(len(n.children))})
+	if isJoinOp(n.op) {
+		if jt, ok := n.args["type"]; ok {
+			fmt.Fprintf(h, "%v;", jt)
+		}
+	}
+	for _, child := range n.children {
+		fingerprintNode(h, child)
+	}
+}
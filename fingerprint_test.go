@@ -0,0 +1,36 @@
+package gistdecoder
+
+import "testing"
+
+func hashJoinGist(leftTable, rightTable int, joinType byte) string {
+	return newGistBuilder().
+		scan(leftTable, 1, 0, 0, 0).
+		scan(rightTable, 2, 1, 0, 0).
+		op(hashJoinOp).byte(joinType).int(1).int(1).bool(false).bool(false).
+		String()
+}
+
+func TestPlanFingerprintSameShape(t *testing.T) {
+	a := mustDecode(t, hashJoinGist(112, 113, 0))
+	b := mustDecode(t, hashJoinGist(200, 201, 0))
+
+	if PlanFingerprint(a) != PlanFingerprint(b) {
+		t.Error("Expected plans with the same shape but different tables to have equal fingerprints")
+	}
+}
+
+func TestPlanFingerprintDifferentShape(t *testing.T) {
+	base := mustDecode(t, hashJoinGist(112, 113, 0))
+
+	others := map[string]*Node{
+		"join type":  mustDecode(t, hashJoinGist(112, 113, 1)),
+		"structure":  mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"),
+		"single op":  mustDecode(t, newGistBuilder().scan(112, 1, 0, 0, 0).String()),
+		"extra node": mustDecode(t, newGistBuilder().scan(112, 1, 0, 0, 0).op(filterOp).String()),
+	}
+	for name, other := range others {
+		if PlanFingerprint(base) == PlanFingerprint(other) {
+			t.Errorf("Expected %s difference to change the fingerprint", name)
+		}
+	}
+}
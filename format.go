@@ -1,33 +1,231 @@
 package gistdecoder
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"strings"
 )
 
-// formatNode formats a single node with proper tree characters.
-// This function is called recursively to build the complete plan output.
-func formatNode(n *Node, prefix string, isLast bool) string {
+// FormatOptions adjusts the output of FormatPlanWithOptions. The zero value
+// gives the output of FormatPlan.
+type FormatOptions struct {
+	// CockroachCompat labels attributes the way CockroachDB's EXPLAIN does,
+	// so that the output diffs cleanly against EXPLAIN in cockroach sql:
+	//   - join types are shown in the operator line, e.g. "• hash join
+	//     (left outer)", and omitted for inner joins, instead of a "type:"
+	//     attribute
+	//   - joins without equality columns are shown as "• cross join"
+	//   - inserts and upserts label their table "into:", and deletes
+	//     "from:"
+	//   - values operators with a single row say "1 row"
+	//   - a line holding only "│" separates every operator's attributes
+	//     from its children
+	//   - scan, index join, and mutation column counts are omitted
+	CockroachCompat bool
+
+	// Color wraps operator names and risky attributes in ANSI color codes
+	// for terminals: scans are yellow, full scans and their FULL SCAN spans
+	// red, and joins cyan.
+	Color bool
+
+	// ShowNodeIDs prefixes each operator line with the node's position in
+	// Walk order, starting at 1, e.g. "[3] • hash join", so a plan's nodes
+	// can be referred to by number. Collapsed projections are not shown but
+	// still take up an ID, so the IDs always agree with Walk.
+	ShowNodeIDs bool
+
+	// ASCII draws the tree with ASCII characters only, for terminals, logs,
+	// and diffs that mangle the Unicode glyphs: "•" becomes "*", "│" "|",
+	// "├──" "|--", and "└──" "`--".
+	ASCII bool
+
+	// IndentPrefix is written at the start of every line, for embedding the
+	// plan in other output such as a YAML block or a markdown list. The tree
+	// is laid out after it unchanged. An empty prefix means the default of
+	// two spaces.
+	IndentPrefix string
+
+	// MaxBytes limits the output to about that many bytes, so that a huge
+	// plan can't produce an unbounded string. Once the next line would take
+	// the output past the limit, formatting stops and a final "...
+	// (truncated)" line, which isn't counted against the limit, is written
+	// instead. Zero means no limit.
+	MaxBytes int
+}
+
+// truncatedMarker ends output cut short by FormatOptions.MaxBytes.
+const truncatedMarker = "... (truncated)\n"
+
+// asciiTree replaces the tree glyphs when FormatOptions.ASCII is set.
+var asciiTree = strings.NewReplacer("•", "*", "│", "|", "├──", "|--", "└──", "`--")
+
+// ANSI escape codes used when FormatOptions.Color is set.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// colorize wraps s in the given ANSI color if opts.Color is set.
+func colorize(s, color string, opts FormatOptions) string {
+	if !opts.Color || color == "" {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// nodeColor returns the ANSI color of n's operator name, or "" if it is not
+// highlighted.
+func nodeColor(n *Node) string {
+	switch {
+	case isFullScan(n):
+		return ansiRed
+	case n.op == scanOp:
+		return ansiYellow
+	case isJoinOp(n.op):
+		return ansiCyan
+	}
+	return ""
+}
+
+// mutationColumnSets lists the column set counts that mutations record, in
+// the order they are formatted.
+var mutationColumnSets = []struct {
+	arg, label string
+}{
+	{"insert_cols", "insert columns"},
+	{"fetch_cols", "fetch columns"},
+	{"update_cols", "update columns"},
+	{"return_cols", "return columns"},
+	{"check_cols", "check columns"},
+}
+
+// planOpName returns the operator name of n, or "root" for the synthetic
+// node decoding places above a plan with constraint checks.
+func planOpName(n *Node) string {
+	if isChecksWrapper(n) {
+		return "root"
+	}
+	return opName(n.op)
+}
+
+// nodeName returns the name of n's operator as shown on its operator line.
+func nodeName(n *Node, opts FormatOptions) string {
+	name := planOpName(n)
+	if opts.CockroachCompat && isCrossJoin(n) {
+		name = "cross join"
+	}
+	if opts.CockroachCompat && isJoinOp(n.op) {
+		if jt, ok := n.args["type"]; ok && jt != "inner" {
+			return fmt.Sprintf("%s (%v)", name, jt)
+		}
+	}
+	return name
+}
+
+// planWriter writes formatted plan lines to an io.Writer, tracking the
+// number of bytes written and the first write error. Once a write fails,
+// later writes are skipped.
+//
+// The buffers are shared by every node of the plan so that formatting a deep
+// plan doesn't build a new prefix string per node and line: prefix holds the
+// indentation of the node being formatted, growing by one level on the way
+// down and truncated on the way back up.
+type planWriter struct {
+	w    io.Writer
+	n    int64
+	err  error
+	opts FormatOptions
+	// nodes counts the nodes formatted so far, numbering them in Walk order.
+	nodes int
+	// prefix is written before every line but a node's first.
+	prefix []byte
+	// node holds the lines of the node being formatted.
+	node bytes.Buffer
+	// line holds the line being written.
+	line []byte
+	// truncated is set once output has been cut short by opts.MaxBytes.
+	truncated bool
+}
+
+// push adds indent to the prefix, returning the length to restore with pop.
+func (pw *planWriter) push(indent string) int {
+	base := len(pw.prefix)
+	pw.prefix = append(pw.prefix, indent...)
+	return base
+}
+
+// pop restores the prefix saved by push.
+func (pw *planWriter) pop(base int) {
+	pw.prefix = pw.prefix[:base]
+}
+
+// writeLines writes each line of s, prefixing the first with the prefix up
+// to base followed by connector, and the rest with the whole prefix.
+func (pw *planWriter) writeLines(s []byte, base int, connector string) {
+	for first := true; len(s) > 0 && pw.err == nil && !pw.truncated; first = false {
+		line, tail, _ := bytes.Cut(s, []byte("\n"))
+		if first {
+			pw.line = append(append(pw.line[:0], pw.prefix[:base]...), connector...)
+		} else {
+			pw.line = append(pw.line[:0], pw.prefix...)
+		}
+		pw.line = append(append(pw.line, line...), '\n')
+		out := pw.line
+		if pw.opts.ASCII {
+			out = []byte(asciiTree.Replace(string(out)))
+		}
+		if max := pw.opts.MaxBytes; max > 0 && pw.n+int64(len(out)) > int64(max) {
+			pw.truncated = true
+			out = append(out[:0], pw.opts.IndentPrefix...)
+			out = append(out, truncatedMarker...)
+		}
+		n, err := pw.w.Write(out)
+		pw.n += int64(n)
+		pw.err = err
+		s = tail
+	}
+}
+
+// formatNode writes a single node and its descendants with proper tree
+// characters. The operator line is prefixed with the writer's prefix and
+// connector, which comes from the parent, and every later line with the
+// prefix and indent, which carries the parent's vertical bars, so columns
+// stay aligned at any depth.
+func formatNode(pw *planWriter, n *Node, connector, indent string) {
+	if pw.truncated {
+		return
+	}
 	if n == nil {
-		return ""
+		// A nil child, such as one built by hand, still gets a line so the
+		// connector leading to it isn't left dangling.
+		pw.writeLines([]byte("• <missing>"), len(pw.prefix), connector)
+		return
 	}
+	opts := pw.opts
+	pw.nodes++
 
 	// Skip trivial projections (like CockroachDB does in non-verbose mode)
-	if n.op == simpleProjectOp || n.op == serializingProjectOp {
+	if isProjectionOp(n.op) {
 		if len(n.children) > 0 {
-			return formatNode(n.children[0], prefix, isLast)
+			formatNode(pw, n.children[0], connector, indent)
 		}
-		return ""
+		return
 	}
 
-	var sb strings.Builder
+	base := pw.push(indent)
+	defer pw.pop(base)
+
+	sb := &pw.node
+	sb.Reset()
 
 	// Node name with tree character
-	opName := opNames[n.op]
-	if opName == "" {
-		opName = fmt.Sprintf("op_%d", n.op)
+	if opts.ShowNodeIDs {
+		fmt.Fprintf(sb, "[%d] ", pw.nodes)
 	}
-	sb.WriteString(fmt.Sprintf("• %s\n", opName))
+	fmt.Fprintf(sb, "• %s\n", colorize(nodeName(n, opts), nodeColor(n), opts))
 
 	// Determine attribute prefix
 	// The │ should align with the • above it
@@ -39,66 +237,171 @@ func formatNode(n *Node, prefix string, isLast bool) string {
 	}
 
 	// Special handling for different operators
-	if n.op == scanOp {
+	if isChecksWrapper(n) {
+		// Like CockroachDB, the main plan and its constraint checks hang
+		// under a root with no attributes of its own.
+		fmt.Fprintf(sb, "%s\n", strings.TrimRight(attrPrefix, " "))
+	} else if n.op == scanOp {
 		table := n.args["table"]
 		index := n.args["index"]
-		sb.WriteString(fmt.Sprintf("%stable: %s@%s\n", attrPrefix, table, index))
-		if spans, ok := n.args["spans"]; ok {
-			// Format as "1+ spans" if multiple
-			if strings.Contains(fmt.Sprint(spans), " ") {
-				parts := strings.Fields(fmt.Sprint(spans))
-				sb.WriteString(fmt.Sprintf("%sspans: %s+ spans\n", attrPrefix, parts[0]))
-			} else {
-				sb.WriteString(fmt.Sprintf("%sspans: %v\n", attrPrefix, spans))
+		fmt.Fprintf(sb, "%stable: %s@%s\n", attrPrefix, table, index)
+		if cols, ok := n.args["needed_cols"].(int); ok && cols > 0 && !opts.CockroachCompat {
+			fmt.Fprintf(sb, "%scolumns: %d\n", attrPrefix, cols)
+		}
+		if _, ok := n.args["index_constraint"]; ok {
+			fmt.Fprintf(sb, "%sspans: 1+ spans\n", attrPrefix)
+		} else if fullScan, _ := n.args["full_scan"].(bool); fullScan {
+			label := "FULL SCAN"
+			if _, limited := n.args["hard_limit"]; limited {
+				label = "FULL SCAN (LIMITED)"
 			}
-		} else {
-			sb.WriteString(fmt.Sprintf("%sspans: FULL SCAN\n", attrPrefix))
+			fmt.Fprintf(sb, "%sspans: %s\n", attrPrefix, colorize(label, ansiRed, opts))
 		}
-		if limit, ok := n.args["limit"]; ok {
-			sb.WriteString(fmt.Sprintf("%slimit: %v\n", attrPrefix, limit))
+		if _, ok := n.args["inverted_constraint"]; ok {
+			fmt.Fprintf(sb, "%sinverted constraint\n", attrPrefix)
 		}
-	} else if n.op == hashJoinOp || n.op == mergeJoinOp || n.op == lookupJoinOp {
-		if jt, ok := n.args["type"]; ok {
-			sb.WriteString(fmt.Sprintf("%stype: %v\n", attrPrefix, jt))
+		if _, ok := n.args["hard_limit"]; ok {
+			fmt.Fprintf(sb, "%slimit\n", attrPrefix)
+		}
+	} else if n.op == hashJoinOp || n.op == mergeJoinOp || n.op == lookupJoinOp || n.op == applyJoinOp {
+		if jt, ok := n.args["type"]; ok && !opts.CockroachCompat {
+			if jt == "inner" && isCrossJoin(n) {
+				jt = "cross"
+			}
+			fmt.Fprintf(sb, "%stype: %v\n", attrPrefix, jt)
 		}
 		if table, ok := n.args["table"]; ok {
 			index := n.args["index"]
-			sb.WriteString(fmt.Sprintf("%stable: %s@%s\n", attrPrefix, table, index))
+			fmt.Fprintf(sb, "%stable: %s@%s\n", attrPrefix, table, index)
+		}
+		// Zero equality columns would only restate that the join is a cross
+		// join, so the line is left out.
+		if leftCols, ok := n.args["left_eq_cols"].(int); ok && leftCols > 0 {
+			fmt.Fprintf(sb, "%sequality cols: %v\n", attrPrefix, leftCols)
 		}
-		if leftCols, ok := n.args["left_eq_cols"]; ok {
-			sb.WriteString(fmt.Sprintf("%sequality cols: %v\n", attrPrefix, leftCols))
+		if eqCols, ok := n.args["equality_cols"].(int); ok && eqCols > 0 {
+			fmt.Fprintf(sb, "%sequality cols: %v\n", attrPrefix, eqCols)
+		}
+		if _, ok := n.args["eq_cols_are_key"]; ok {
+			fmt.Fprintf(sb, "%sequality cols are key\n", attrPrefix)
+		}
+		if _, ok := n.args["left_key"]; ok {
+			fmt.Fprintf(sb, "%sleft cols are key\n", attrPrefix)
+		}
+		if _, ok := n.args["right_key"]; ok {
+			fmt.Fprintf(sb, "%sright cols are key\n", attrPrefix)
+		}
+		if _, ok := n.args["correlated"]; ok {
+			fmt.Fprintf(sb, "%scorrelated\n", attrPrefix)
 		}
 	} else if n.op == indexJoinOp {
 		if table, ok := n.args["table"]; ok {
-			sb.WriteString(fmt.Sprintf("%stable: %s\n", attrPrefix, table))
+			fmt.Fprintf(sb, "%stable: %s\n", attrPrefix, table)
+		}
+		if keyCols, ok := n.args["key_cols"].(int); ok && keyCols > 0 && !opts.CockroachCompat {
+			fmt.Fprintf(sb, "%skey cols: %d\n", attrPrefix, keyCols)
 		}
 	} else if n.op == valuesOp {
 		if rows, ok := n.args["rows"]; ok {
-			sb.WriteString(fmt.Sprintf("%ssize: %v columns, %v rows\n", attrPrefix, n.args["columns"], rows))
+			unit := "rows"
+			if opts.CockroachCompat && rows == 1 {
+				unit = "row"
+			}
+			fmt.Fprintf(sb, "%ssize: %v columns, %v %s\n", attrPrefix, n.args["columns"], rows, unit)
+		}
+	} else if n.op == bufferOp || n.op == scanBufferOp {
+		if id, ok := n.args["buffer_id"]; ok {
+			fmt.Fprintf(sb, "%slabel: buffer %v\n", attrPrefix, id)
+		}
+	} else if n.op == recursiveCTEOp {
+		if dedup, _ := n.args["deduplicate"].(bool); dedup {
+			fmt.Fprintf(sb, "%sdeduplicate\n", attrPrefix)
+		}
+	} else if n.op == groupByOp {
+		if cols, ok := n.args["group_cols"]; ok {
+			strategy := "hash"
+			if ordered, _ := n.args["ordered"].(bool); ordered {
+				strategy = "streaming"
+			}
+			fmt.Fprintf(sb, "%sgroup by: %v cols (%s)\n", attrPrefix, cols, strategy)
 		}
 	} else if n.op == topKOp {
 		if k, ok := n.args["k"]; ok {
-			sb.WriteString(fmt.Sprintf("%sk: %v\n", attrPrefix, k))
+			fmt.Fprintf(sb, "%sk: %v\n", attrPrefix, k)
 		}
 	} else if n.op == insertOp || n.op == updateOp || n.op == deleteOp || n.op == upsertOp {
 		if table, ok := n.args["table"]; ok {
-			sb.WriteString(fmt.Sprintf("%stable: %s\n", attrPrefix, table))
+			label := "table"
+			if opts.CockroachCompat {
+				switch n.op {
+				case insertOp, upsertOp:
+					label = "into"
+				case deleteOp:
+					label = "from"
+				}
+			}
+			fmt.Fprintf(sb, "%s%s: %s\n", attrPrefix, label, table)
 		}
 		// For updates, add "set" like CockroachDB does
 		if n.op == updateOp {
-			sb.WriteString(fmt.Sprintf("%sset\n", attrPrefix))
+			fmt.Fprintf(sb, "%sset\n", attrPrefix)
+		}
+		// EXPLAIN names the columns instead, which gists don't encode.
+		for _, cols := range mutationColumnSets {
+			if count, ok := n.args[cols.arg].(int); ok && count > 0 && !opts.CockroachCompat {
+				fmt.Fprintf(sb, "%s%s: %d\n", attrPrefix, cols.label, count)
+			}
+		}
+		if returning, _ := n.args["has_returning"].(bool); returning && !opts.CockroachCompat {
+			fmt.Fprintf(sb, "%sreturning\n", attrPrefix)
+		}
+		if autoCommit, _ := n.args["auto_commit"].(bool); autoCommit {
+			fmt.Fprintf(sb, "%sauto commit\n", attrPrefix)
 		}
 		if len(n.children) > 0 {
 			// Empty line with just the vertical bar before children
-			sb.WriteString(fmt.Sprintf("%s\n", strings.TrimRight(attrPrefix, " ")))
+			fmt.Fprintf(sb, "%s\n", strings.TrimRight(attrPrefix, " "))
+		}
+	} else if n.op == createTableOp || n.op == createTableAsOp || n.op == createFunctionOp || n.op == createViewOp {
+		if schemaID, ok := n.args["schema_id"]; ok {
+			fmt.Fprintf(sb, "%sschema: %v\n", attrPrefix, schemaID)
+		}
+		if cols, ok := n.args["columns"]; ok {
+			fmt.Fprintf(sb, "%scolumns: %v\n", attrPrefix, cols)
+		}
+	} else if n.op == exportOp {
+		if cols, ok := n.args["not_null_cols"].(int); ok && cols > 0 {
+			fmt.Fprintf(sb, "%snot null columns: %v\n", attrPrefix, cols)
+		}
+	} else if n.op == alterTableSplitOp || n.op == alterTableUnsplitOp || n.op == alterTableUnsplitAllOp || n.op == alterTableRelocateOp {
+		fmt.Fprintf(sb, "%sindex: %s@%s\n", attrPrefix, n.args["table"], n.args["index"])
+	} else if n.op == sequenceSelectOp {
+		if seq, ok := n.args["sequence"]; ok {
+			fmt.Fprintf(sb, "%ssequence: %s\n", attrPrefix, seq)
+		}
+	} else if n.op == cancelQueriesOp || n.op == cancelSessionsOp {
+		if _, ok := n.args["if_exists"]; ok {
+			fmt.Fprintf(sb, "%sif exists\n", attrPrefix)
+		}
+	} else if n.op == showTraceOp {
+		if _, ok := n.args["compact"]; ok {
+			fmt.Fprintf(sb, "%scompact\n", attrPrefix)
 		}
 	} else if n.op == renderOp {
 		// Render typically doesn't show attributes in simplified mode
 		if len(n.children) > 0 {
-			sb.WriteString(fmt.Sprintf("%s\n", strings.TrimRight(attrPrefix, " ")))
+			fmt.Fprintf(sb, "%s\n", strings.TrimRight(attrPrefix, " "))
 		}
 	}
 
+	// CockroachDB separates every operator's attributes from its children
+	// with a bare vertical bar; render and mutations already do so above.
+	if opts.CockroachCompat && len(n.children) > 0 && !bytes.HasSuffix(sb.Bytes(), []byte("│\n")) {
+		fmt.Fprintf(sb, "%s\n", strings.TrimRight(attrPrefix, " "))
+	}
+
+	pw.writeLines(sb.Bytes(), base, connector)
+
 	// Format children
 	for i, child := range n.children {
 		childIsLast := i == len(n.children)-1
@@ -113,20 +416,17 @@ func formatNode(n *Node, prefix string, isLast bool) string {
 			childPrefix = "│   "
 		}
 
-		sb.WriteString(connector)
-		childStr := formatNode(child, childPrefix, childIsLast)
-		// Insert child output, handling multiline output
-		lines := strings.Split(strings.TrimSuffix(childStr, "\n"), "\n")
-		for j, line := range lines {
-			if j == 0 {
-				sb.WriteString(line + "\n")
-			} else {
-				sb.WriteString(childPrefix + line + "\n")
-			}
+		if isChecksWrapper(n) && i > 0 {
+			// Place each check under a constraint-check operator, as
+			// CockroachDB's EXPLAIN shows the checks run after the main plan.
+			checkBase := pw.push(childPrefix)
+			pw.writeLines([]byte("• constraint-check\n│"), checkBase, connector)
+			formatNode(pw, child, "└── ", "    ")
+			pw.pop(checkBase)
+			continue
 		}
+		formatNode(pw, child, connector, childPrefix)
 	}
-
-	return sb.String()
 }
 
 // FormatPlan formats a decoded plan tree as EXPLAIN-style output.
@@ -149,17 +449,37 @@ func formatNode(n *Node, prefix string, isLast bool) string {
 //	      │
 //	      └── • scan
 //	            table: 112@1
+//	            columns: 9
 //	            spans: 1+ spans
 func FormatPlan(n *Node) string {
+	return FormatPlanWithOptions(n, FormatOptions{})
+}
+
+// FormatPlanWithOptions is like FormatPlan, but formats the plan according to
+// opts.
+func FormatPlanWithOptions(n *Node, opts FormatOptions) string {
+	var sb strings.Builder
+	formatPlanTo(&sb, n, opts)
+	return sb.String()
+}
+
+// FormatPlanTo writes the output of FormatPlan to w as it is produced, one
+// operator at a time, instead of building the whole plan in memory. It
+// returns the number of bytes written and the first error encountered.
+func FormatPlanTo(w io.Writer, n *Node) (int64, error) {
+	return formatPlanTo(w, n, FormatOptions{})
+}
+
+func formatPlanTo(w io.Writer, n *Node, opts FormatOptions) (int64, error) {
 	if n == nil {
-		return ""
+		return 0, nil
 	}
 	// Add the leading indentation
-	output := formatNode(n, "", true)
-	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
-	var sb strings.Builder
-	for _, line := range lines {
-		sb.WriteString("  " + line + "\n")
+	if opts.IndentPrefix == "" {
+		opts.IndentPrefix = "  "
 	}
-	return sb.String()
+	pw := &planWriter{w: w, opts: opts}
+	indent := opts.IndentPrefix
+	formatNode(pw, n, indent, indent)
+	return pw.n, pw.err
 }
@@ -0,0 +1,437 @@
+package gistdecoder
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite the .golden files in testdata with the current output")
+
+// checkGoldenFiles decodes each .gist file in dir, formats the plan with
+// format, and compares the output byte-for-byte with the .golden file of
+// the same name. With -update, the .golden files are rewritten instead.
+func checkGoldenFiles(t *testing.T, dir string, format func(*Node) string) {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.gist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("Expected gists in %s", dir)
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".gist")
+		t.Run(name, func(t *testing.T) {
+			gist, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := format(mustDecode(t, strings.TrimSpace(string(gist))))
+
+			goldenPath := strings.TrimSuffix(path, ".gist") + ".golden"
+			if *update {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(expected) {
+				t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+			}
+		})
+	}
+}
+
+// TestFormatPlanGolden checks FormatPlan against testdata/format. Run
+// go test -run TestFormatPlanGolden -update to regenerate the golden files
+// after an intended formatting change.
+func TestFormatPlanGolden(t *testing.T) {
+	checkGoldenFiles(t, filepath.Join("testdata", "format"), FormatPlan)
+}
+
+// TestFormatPlanCockroachCompatGolden checks CockroachCompat output against
+// the snapshots in testdata/compat. The snapshots were written with -update
+// from the decoder's own output, mostly for gists made with gistBuilder, so
+// they catch regressions but are not EXPLAIN text captured from
+// CockroachDB.
+func TestFormatPlanCockroachCompatGolden(t *testing.T) {
+	checkGoldenFiles(t, filepath.Join("testdata", "compat"), func(n *Node) string {
+		return FormatPlanWithOptions(n, FormatOptions{CockroachCompat: true})
+	})
+}
+
+func TestFormatPlanDefaultLabels(t *testing.T) {
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(113, 1, 0, 0, 0).
+		op(hashJoinOp).byte(1).int(1).int(1).bool(false).bool(false).
+		String()
+	node := mustDecode(t, gist)
+
+	output := FormatPlanWithOptions(node, FormatOptions{})
+	if output != FormatPlan(node) {
+		t.Errorf("Expected the zero FormatOptions to match FormatPlan, got:\n%s", output)
+	}
+	if !strings.Contains(output, "• hash join\n") || !strings.Contains(output, "│ type: left outer\n") {
+		t.Errorf("Expected the join type as an attribute by default, got:\n%s", output)
+	}
+}
+
+func TestFormatPlanJoinEqualityCols(t *testing.T) {
+	tests := []struct {
+		name     string
+		join     func(b *gistBuilder) *gistBuilder
+		expected []string
+		absent   []string
+	}{
+		{
+			name: "cross join",
+			join: func(b *gistBuilder) *gistBuilder {
+				return b.op(hashJoinOp).byte(0).int(0).int(0).bool(false).bool(false)
+			},
+			expected: []string{"• hash join\n", "│ type: cross\n"},
+			absent:   []string{"equality cols"},
+		},
+		{
+			name: "hash equijoin",
+			join: func(b *gistBuilder) *gistBuilder {
+				return b.op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false)
+			},
+			expected: []string{"• hash join\n", "│ type: inner\n", "│ equality cols: 1\n"},
+		},
+		{
+			name: "merge equijoin",
+			join: func(b *gistBuilder) *gistBuilder {
+				return b.op(mergeJoinOp).byte(0).int(2).int(2).bool(false).bool(false)
+			},
+			expected: []string{"• merge join\n", "│ type: inner\n", "│ equality cols: 2\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gist := tt.join(newGistBuilder().scan(112, 1, 0, 0, 0).scan(113, 1, 0, 0, 0)).String()
+			output := FormatPlan(mustDecode(t, gist))
+			for _, expected := range tt.expected {
+				if !strings.Contains(output, expected) {
+					t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(output, absent) {
+					t.Errorf("Expected output not to contain %q, got:\n%s", absent, output)
+				}
+			}
+		})
+	}
+
+	cross := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(113, 1, 0, 0, 0).
+		op(hashJoinOp).byte(1).int(0).int(0).bool(false).bool(false).
+		String()
+	output := FormatPlanWithOptions(mustDecode(t, cross), FormatOptions{CockroachCompat: true})
+	if !strings.Contains(output, "• cross join (left outer)\n") {
+		t.Errorf("Expected a cross join header in compat mode, got:\n%s", output)
+	}
+}
+
+func TestFormatPlanShowNodeIDs(t *testing.T) {
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(113, 1, 1, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		op(sortOp).
+		String()
+	node := mustDecode(t, gist)
+
+	expected := `  [1] • sort
+  └── [2] • hash join
+      │ type: inner
+      │ equality cols: 1
+      ├── [3] • scan
+      │     table: 112@1
+      │     spans: FULL SCAN
+      └── [4] • scan
+            table: 113@1
+            spans: 1+ spans
+`
+	output := FormatPlanWithOptions(node, FormatOptions{ShowNodeIDs: true})
+	if output != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	// The IDs follow Walk order, counting the projections that formatting
+	// collapses.
+	var walked []string
+	Walk(node, func(n *Node) bool {
+		walked = append(walked, opName(n.op))
+		return true
+	})
+	if expected := []string{"sort", "hash join", "scan", "scan"}; !reflect.DeepEqual(walked, expected) {
+		t.Errorf("Expected Walk order %v, got %v", expected, walked)
+	}
+
+	gist = newGistBuilder().scan(112, 1, 1, 0, 0).op(simpleProjectOp).int(1).op(limitOp).String()
+	output = FormatPlanWithOptions(mustDecode(t, gist), FormatOptions{ShowNodeIDs: true})
+	if !strings.Contains(output, "[1] • limit") || !strings.Contains(output, "[3] • scan") {
+		t.Errorf("Expected the collapsed projection to take ID 2, got:\n%s", output)
+	}
+}
+
+func TestFormatPlanASCII(t *testing.T) {
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(113, 1, 1, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		op(sortOp).
+		String()
+	node := mustDecode(t, gist)
+
+	expected := `  * sort
+  ` + "`" + `-- * hash join
+      | type: inner
+      | equality cols: 1
+      |-- * scan
+      |     table: 112@1
+      |     spans: FULL SCAN
+      ` + "`" + `-- * scan
+            table: 113@1
+            spans: 1+ spans
+`
+	output := FormatPlanWithOptions(node, FormatOptions{ASCII: true})
+	if output != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+	for i, r := range output {
+		if r >= utf8.RuneSelf {
+			t.Fatalf("Expected ASCII output, got %q at byte %d", r, i)
+		}
+	}
+
+	// Only the glyphs change; the layout is the same as the Unicode tree.
+	unicode := FormatPlan(node)
+	if len(strings.Split(unicode, "\n")) != len(strings.Split(output, "\n")) {
+		t.Errorf("Expected the same lines as the Unicode tree, got:\n%s", output)
+	}
+}
+
+func TestFormatPlanIndentPrefix(t *testing.T) {
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+	defaultOutput := FormatPlan(node)
+
+	const prefix = "    > "
+	output := FormatPlanWithOptions(node, FormatOptions{IndentPrefix: prefix})
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	defaultLines := strings.Split(strings.TrimSuffix(defaultOutput, "\n"), "\n")
+	if len(lines) != len(defaultLines) {
+		t.Fatalf("Expected %d lines, got:\n%s", len(defaultLines), output)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, prefix) {
+			t.Errorf("Expected line %d to start with %q, got %q", i, prefix, line)
+			continue
+		}
+		// Past the prefix, the tree is laid out exactly as by default.
+		if got, want := strings.TrimPrefix(line, prefix), strings.TrimPrefix(defaultLines[i], "  "); got != want {
+			t.Errorf("Expected line %d to be %q after the prefix, got %q", i, want, got)
+		}
+	}
+}
+
+func TestFormatPlanMaxBytes(t *testing.T) {
+	node := deepPlan(t, 500)
+	full := FormatPlan(node)
+
+	const maxBytes = 1024
+	output := FormatPlanWithOptions(node, FormatOptions{MaxBytes: maxBytes})
+	kept, marker, ok := strings.Cut(output, "  ... (truncated)\n")
+	if !ok || marker != "" {
+		t.Fatalf("Expected output to end with the truncation marker, got:\n%s", output)
+	}
+	if len(kept) > maxBytes {
+		t.Errorf("Expected at most %d bytes before the marker, got %d", maxBytes, len(kept))
+	}
+	// Output is cut at a line boundary, keeping a prefix of the full plan.
+	if !strings.HasPrefix(full, kept) || !strings.HasSuffix(kept, "\n") {
+		t.Errorf("Expected whole lines of the full plan before the marker, got:\n%s", kept)
+	}
+
+	// A plan within the limit is left alone.
+	small := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+	if got, want := FormatPlanWithOptions(small, FormatOptions{MaxBytes: maxBytes}), FormatPlan(small); got != want {
+		t.Errorf("Expected untruncated output:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestFormatPlanNilChild(t *testing.T) {
+	scan := &Node{op: scanOp, args: map[string]interface{}{"table": "112", "index": "1"}}
+	node := &Node{
+		op:       hashJoinOp,
+		args:     map[string]interface{}{"type": "inner"},
+		children: []*Node{nil, scan},
+	}
+
+	expected := `  • hash join
+  │ type: inner
+  ├── • <missing>
+  └── • scan
+        table: 112@1
+`
+	if output := FormatPlan(node); output != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	// A projection over a nil input collapses to the placeholder too.
+	node = &Node{op: filterOp, children: []*Node{{op: simpleProjectOp, children: []*Node{nil}}}}
+	if output := FormatPlan(node); !strings.HasSuffix(output, "  └── • <missing>\n") {
+		t.Errorf("Expected a placeholder for the missing input, got:\n%s", output)
+	}
+}
+
+func TestFormatPlanConstraintChecks(t *testing.T) {
+	// INSERT INTO child VALUES (1, 2), where child.parent_id references
+	// parent(id). The foreign key check is an anti join into parent.
+	gist := newGistBuilder().
+		op(valuesOp).int(1).int(2).
+		op(bufferOp).int(1).
+		op(insertOp).int(113).intSet(0, 1).emptyIntSet().emptyIntSet().bool(false).
+		op(scanBufferOp).int(1).
+		op(lookupJoinOp).byte(5).int(112).int(1).int(1).bool(true).
+		op(errorIfRowsOp).
+		String()
+
+	output := FormatPlan(mustDecode(t, gist))
+	if strings.Contains(output, "op_0") {
+		t.Errorf("Expected the checks wrapper not to be shown as op_0, got:\n%s", output)
+	}
+	for _, expected := range []string{
+		"  • root\n",
+		"  ├── • insert\n",
+		"  └── • constraint-check\n",
+		"      └── • error if rows\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestFormatPlanTo(t *testing.T) {
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+
+	var buf bytes.Buffer
+	n, err := FormatPlanTo(&buf, node)
+	if err != nil {
+		t.Fatalf("Failed to format: %v", err)
+	}
+	expected := FormatPlan(node)
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+	if n != int64(len(expected)) {
+		t.Errorf("Expected %d bytes written, got %d", len(expected), n)
+	}
+
+	buf.Reset()
+	if n, err := FormatPlanTo(&buf, nil); n != 0 || err != nil || buf.Len() != 0 {
+		t.Errorf("Expected nothing written for a nil plan, got %d, %v, %q", n, err, buf.String())
+	}
+}
+
+// failingWriter accepts limit bytes and then fails every write.
+type failingWriter struct {
+	limit  int
+	writes int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, errWriteFailed
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestFormatPlanToWriteError(t *testing.T) {
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+
+	w := &failingWriter{limit: 20}
+	n, err := FormatPlanTo(w, node)
+	if !errors.Is(err, errWriteFailed) {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+	if n != 20 {
+		t.Errorf("Expected 20 bytes written before the failure, got %d", n)
+	}
+	if w.writes >= strings.Count(FormatPlan(node), "\n") {
+		t.Errorf("Expected writing to stop after the failure, got %d writes", w.writes)
+	}
+}
+
+func TestFormatPlanColor(t *testing.T) {
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(113, 1, 1, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		String()
+	node := mustDecode(t, gist)
+
+	plain := FormatPlan(node)
+	if strings.Contains(plain, "\x1b[") {
+		t.Errorf("Expected no ANSI codes by default, got %q", plain)
+	}
+
+	colored := FormatPlanWithOptions(node, FormatOptions{Color: true})
+	for _, expected := range []string{
+		"• \x1b[36mhash join\x1b[0m\n",
+		"• \x1b[31mscan\x1b[0m\n",
+		"spans: \x1b[31mFULL SCAN\x1b[0m\n",
+		"• \x1b[33mscan\x1b[0m\n",
+	} {
+		if !strings.Contains(colored, expected) {
+			t.Errorf("Expected colored output to contain %q, got %q", expected, colored)
+		}
+	}
+}
+
+// deepPlan returns a left-deep plan of depth hash joins, each joining the
+// plan below it with another scan.
+func deepPlan(tb testing.TB, depth int) *Node {
+	b := newGistBuilder().scan(100, 1, 0, 0, 0)
+	for i := 0; i < depth; i++ {
+		b.scan(101+i, 1, 1, 0, 0).op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false)
+	}
+	node, err := DecodePlanGist(b.String(), nil, nil, WithMaxNodes(0))
+	if err != nil {
+		tb.Fatalf("Failed to decode deep plan: %v", err)
+	}
+	return node
+}
+
+func BenchmarkFormatDeepPlan(b *testing.B) {
+	node := deepPlan(b, 50)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = FormatPlanTo(io.Discard, node)
+	}
+}
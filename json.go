@@ -0,0 +1,104 @@
+package gistdecoder
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonNode is the JSON representation of a plan node.
+type jsonNode struct {
+	Op       string                 `json:"op"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+	Children []*jsonNode            `json:"children,omitempty"`
+}
+
+// JSONOptions adjusts the output of PlanToJSONWithOptions. The zero value
+// gives the same output as PlanToJSON.
+type JSONOptions struct {
+	// HideIDs omits a table, index, or sequence's numeric ID when a lookup
+	// resolved its name, leaving "table_id" out beside "table": "users" but
+	// keeping it beside "table": "112". Without lookups, every ID is kept.
+	// FormatPlan needs no such option, since it shows only the names.
+	HideIDs bool
+}
+
+// namedIDArgs maps each ID argument to the argument holding its name.
+var namedIDArgs = map[string]string{
+	"table_id":    "table",
+	"index_id":    "index",
+	"sequence_id": "sequence",
+}
+
+// resolvedIDArgs returns args without the IDs whose names were resolved by a
+// lookup, which is when the name isn't just the ID formatted as a string.
+// args itself is returned if it has no such IDs.
+func resolvedIDArgs(args map[string]interface{}) map[string]interface{} {
+	var trimmed map[string]interface{}
+	for idArg, nameArg := range namedIDArgs {
+		id, ok := args[idArg]
+		if !ok {
+			continue
+		}
+		if name, ok := args[nameArg].(string); !ok || name == fmt.Sprint(id) {
+			continue
+		}
+		if trimmed == nil {
+			trimmed = make(map[string]interface{}, len(args))
+			for k, v := range args {
+				trimmed[k] = v
+			}
+		}
+		delete(trimmed, idArg)
+	}
+	if trimmed == nil {
+		return args
+	}
+	return trimmed
+}
+
+func toJSONNode(n *Node, opts JSONOptions) *jsonNode {
+	if n == nil {
+		return nil
+	}
+	jn := &jsonNode{
+		Op:   planOpName(n),
+		Args: n.args,
+	}
+	if opts.HideIDs {
+		jn.Args = resolvedIDArgs(n.args)
+	}
+	for _, child := range n.children {
+		jn.Children = append(jn.Children, toJSONNode(child, opts))
+	}
+	return jn
+}
+
+// MarshalJSON encodes the node and its descendants as a JSON object with the
+// operator name under "op", its arguments under "args", and its inputs under
+// "children".
+func (n *Node) MarshalJSON() ([]byte, error) {
+	return json.Marshal(toJSONNode(n, JSONOptions{}))
+}
+
+// PlanToJSON formats a decoded plan tree as indented JSON. Each node is an
+// object with "op", "args", and "children" fields, for example:
+//
+//	{
+//	  "op": "scan",
+//	  "args": {
+//	    "index": "1",
+//	    "table": "112",
+//	    ...
+//	  }
+//	}
+//
+// A nil plan encodes as null.
+func PlanToJSON(n *Node) ([]byte, error) {
+	return PlanToJSONWithOptions(n, JSONOptions{})
+}
+
+// PlanToJSONWithOptions is like PlanToJSON, but encodes the plan according
+// to opts.
+func PlanToJSONWithOptions(n *Node, opts JSONOptions) ([]byte, error) {
+	return json.MarshalIndent(toJSONNode(n, opts), "", "  ")
+}
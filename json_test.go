@@ -0,0 +1,125 @@
+package gistdecoder
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPlanToJSON(t *testing.T) {
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+
+	b, err := PlanToJSON(node)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	var decoded jsonNode
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\n%s", err, b)
+	}
+
+	if decoded.Op != "update" {
+		t.Errorf("Expected root op update, got %q", decoded.Op)
+	}
+	if decoded.Args["table"] != "112" {
+		t.Errorf("Expected root table 112, got %v", decoded.Args["table"])
+	}
+
+	// update -> simple project -> render -> scan
+	var ops []string
+	for jn := &decoded; jn != nil; {
+		ops = append(ops, jn.Op)
+		if len(jn.Children) == 0 {
+			break
+		}
+		jn = jn.Children[0]
+	}
+	expected := []string{"update", "simple project", "render", "scan"}
+	if len(ops) != len(expected) {
+		t.Fatalf("Expected ops %v, got %v", expected, ops)
+	}
+	for i := range expected {
+		if ops[i] != expected[i] {
+			t.Errorf("Expected ops %v, got %v", expected, ops)
+			break
+		}
+	}
+}
+
+func TestPlanToJSONChecks(t *testing.T) {
+	b, err := PlanToJSON(mustDecode(t, newGistBuilder().
+		op(valuesOp).int(1).int(2).
+		op(insertOp).int(113).intSet(0, 1).emptyIntSet().emptyIntSet().bool(false).
+		scan(112, 1, 1, 0, 0).
+		op(errorIfRowsOp).
+		String()))
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	var decoded jsonNode
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\n%s", err, b)
+	}
+	if decoded.Op != "root" || len(decoded.Children) != 2 {
+		t.Errorf("Expected a root op over the plan and its check, got %q with %d children", decoded.Op, len(decoded.Children))
+	}
+}
+
+func TestPlanToJSONNilNode(t *testing.T) {
+	b, err := PlanToJSON(nil)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if string(b) != "null" {
+		t.Errorf("Expected null, got %s", b)
+	}
+}
+
+func TestPlanToJSONHideIDs(t *testing.T) {
+	const gist = "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+	tableLookup := func(id int64) string {
+		if id == 112 {
+			return "users"
+		}
+		return ""
+	}
+	resolved, err := DecodePlanGist(gist, tableLookup, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	parse := func(n *Node) *jsonNode {
+		b, err := PlanToJSONWithOptions(n, JSONOptions{HideIDs: true})
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		var decoded jsonNode
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\n%s", err, b)
+		}
+		return &decoded
+	}
+
+	// The table name resolved, so its ID is hidden; the index name didn't,
+	// so the scan keeps its index ID.
+	decoded := parse(resolved)
+	if _, ok := decoded.Args["table_id"]; ok || decoded.Args["table"] != "users" {
+		t.Errorf("Expected the table name without its ID, got %v", decoded.Args)
+	}
+	scan := decoded.Children[0].Children[0].Children[0]
+	if _, ok := scan.Args["table_id"]; ok {
+		t.Errorf("Expected the scan's table ID to be hidden, got %v", scan.Args)
+	}
+	if _, ok := scan.Args["index_id"]; !ok {
+		t.Errorf("Expected the unresolved index ID to be shown, got %v", scan.Args)
+	}
+	if _, ok := resolved.args["table_id"]; !ok {
+		t.Error("Expected the plan's own args to be left intact")
+	}
+
+	// Without a lookup, every ID is shown.
+	decoded = parse(mustDecode(t, gist))
+	if decoded.Args["table_id"] != float64(112) {
+		t.Errorf("Expected the table ID to be shown, got %v", decoded.Args)
+	}
+}
@@ -0,0 +1,55 @@
+package gistdecoder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// statementMetadata holds the fields of a statement_statistics metadata
+// object that the decoder reads.
+type statementMetadata struct {
+	PlanGist *string `json:"plan_gist"`
+}
+
+// DecodeFromMetadataJSON is like DecodePlanGist, but takes the gist as it
+// comes out of crdb_internal.statement_statistics: either the JSON string
+// selected by metadata->'plan_gist', quotes included, or the whole metadata
+// object holding it under "plan_gist". A bare, unquoted gist is decoded as
+// is.
+//
+// Example:
+//
+//	node, err := DecodeFromMetadataJSON(`{"plan_gist": "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"}`, nil, nil)
+func DecodeFromMetadataJSON(raw string, tableLookup TableLookupFunc, indexLookup IndexLookupFunc, opts ...DecodeOption) (*Node, error) {
+	gist, err := gistFromMetadataJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	return DecodePlanGist(gist, tableLookup, indexLookup, opts...)
+}
+
+// gistFromMetadataJSON extracts the gist from a JSON string or metadata
+// object.
+func gistFromMetadataJSON(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case strings.HasPrefix(raw, "{"):
+		var md statementMetadata
+		if err := json.Unmarshal([]byte(raw), &md); err != nil {
+			return "", fmt.Errorf("metadata JSON decode error: %w", err)
+		}
+		if md.PlanGist == nil {
+			return "", errors.New("metadata has no plan_gist")
+		}
+		return *md.PlanGist, nil
+	case strings.HasPrefix(raw, `"`):
+		var gist string
+		if err := json.Unmarshal([]byte(raw), &gist); err != nil {
+			return "", fmt.Errorf("metadata JSON decode error: %w", err)
+		}
+		return gist, nil
+	}
+	return raw, nil
+}
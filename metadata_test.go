@@ -0,0 +1,42 @@
+package gistdecoder
+
+import "testing"
+
+func TestDecodeFromMetadataJSON(t *testing.T) {
+	const gist = "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+	want := FormatPlan(mustDecode(t, gist))
+
+	testCases := []struct {
+		name string
+		raw  string
+	}{
+		{"quoted string", `"` + gist + `"`},
+		{"quoted string with whitespace", "  \"" + gist + "\"\n"},
+		{"metadata object", `{"db": "defaultdb", "distsql": false, "plan_gist": "` + gist + `", "vec": true}`},
+		{"bare gist", gist},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := DecodeFromMetadataJSON(tc.raw, nil, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := FormatPlan(node); got != want {
+				t.Errorf("Expected plan:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeFromMetadataJSONErrors(t *testing.T) {
+	for _, raw := range []string{
+		`{"db": "defaultdb"}`,
+		`{"plan_gist": `,
+		`"AgHg`,
+		`{"plan_gist": 1}`,
+	} {
+		if _, err := DecodeFromMetadataJSON(raw, nil, nil); err == nil {
+			t.Errorf("Expected an error for %s", raw)
+		}
+	}
+}
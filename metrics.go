@@ -0,0 +1,63 @@
+package gistdecoder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// planMetric is a single gauge exported by FormatPlanMetrics.
+type planMetric struct {
+	name  string
+	help  string
+	value int
+}
+
+// FormatPlanMetrics formats plan shape metrics in the Prometheus text
+// exposition format. The metrics are taken from Stats, so collapsed
+// projections are not counted:
+//
+//	crdb_plan_nodes       operators in the plan
+//	crdb_plan_scans       scan operators
+//	crdb_plan_full_scans  scans with no span constraint
+//	crdb_plan_joins       join operators
+//
+// Every sample carries the given labels, sorted by name.
+func FormatPlanMetrics(n *Node, labels map[string]string) string {
+	stats := Stats(n)
+	metrics := []planMetric{
+		{"crdb_plan_nodes", "Number of operators in the plan.", stats.NodeCount},
+		{"crdb_plan_scans", "Number of scan operators in the plan.", stats.ScanCount},
+		{"crdb_plan_full_scans", "Number of full table or index scans in the plan.", stats.FullScanCount},
+		{"crdb_plan_joins", "Number of join operators in the plan.", stats.JoinCount},
+	}
+
+	labelStr := formatMetricLabels(labels)
+	var sb strings.Builder
+	for _, m := range metrics {
+		sb.WriteString(fmt.Sprintf("# HELP %s %s\n", m.name, m.help))
+		sb.WriteString(fmt.Sprintf("# TYPE %s gauge\n", m.name))
+		sb.WriteString(fmt.Sprintf("%s%s %d\n", m.name, labelStr, m.value))
+	}
+	return sb.String()
+}
+
+// formatMetricLabels renders labels as a Prometheus label set, e.g.
+// {app="web",db="prod"}, or an empty string if there are no labels.
+func formatMetricLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", k, escaper.Replace(labels[k]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
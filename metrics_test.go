@@ -0,0 +1,56 @@
+package gistdecoder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatPlanMetrics(t *testing.T) {
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(113, 1, 1, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		op(renderOp).int(2).
+		String()
+
+	node, err := DecodePlanGist(gist, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	output := FormatPlanMetrics(node, map[string]string{"fingerprint": "abc", "app": "web"})
+
+	expectedLines := []string{
+		`crdb_plan_nodes{app="web",fingerprint="abc"} 4`,
+		`crdb_plan_scans{app="web",fingerprint="abc"} 2`,
+		`crdb_plan_full_scans{app="web",fingerprint="abc"} 1`,
+		`crdb_plan_joins{app="web",fingerprint="abc"} 1`,
+		`# TYPE crdb_plan_scans gauge`,
+	}
+	for _, expected := range expectedLines {
+		if !strings.Contains(output, expected+"\n") {
+			t.Errorf("Expected output to contain line %q.\nOutput:\n%s", expected, output)
+		}
+	}
+}
+
+func TestFormatPlanMetricsNoLabels(t *testing.T) {
+	node, err := DecodePlanGist("AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	output := FormatPlanMetrics(node, nil)
+	for _, expected := range []string{"crdb_plan_nodes 3", "crdb_plan_scans 1", "crdb_plan_full_scans 0", "crdb_plan_joins 0"} {
+		if !strings.Contains(output, expected+"\n") {
+			t.Errorf("Expected output to contain line %q.\nOutput:\n%s", expected, output)
+		}
+	}
+}
+
+func TestFormatMetricLabelsEscaping(t *testing.T) {
+	got := formatMetricLabels(map[string]string{"query": `say "hi"\n`})
+	if want := `{query="say \"hi\"\\n"}`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -1,5 +1,7 @@
 package gistdecoder
 
+import "fmt"
+
 // execOperator represents different plan operators in CockroachDB.
 type execOperator byte
 
@@ -75,40 +77,196 @@ const (
 
 // opNames maps operator codes to human-readable names.
 var opNames = map[execOperator]string{
-	scanOp:               "scan",
-	valuesOp:             "values",
-	filterOp:             "filter",
-	invertedFilterOp:     "inverted filter",
-	simpleProjectOp:      "simple project",
-	serializingProjectOp: "serializing project",
-	renderOp:             "render",
-	applyJoinOp:          "apply join",
-	hashJoinOp:           "hash join",
-	mergeJoinOp:          "merge join",
-	groupByOp:            "group by",
-	scalarGroupByOp:      "scalar group by",
-	distinctOp:           "distinct",
-	hashSetOpOp:          "hash set op",
-	streamingSetOpOp:     "streaming set op",
-	unionAllOp:           "union all",
-	sortOp:               "sort",
-	ordinalityOp:         "ordinality",
-	indexJoinOp:          "index join",
-	lookupJoinOp:         "lookup join",
-	invertedJoinOp:       "inverted join",
-	zigzagJoinOp:         "zigzag join",
-	limitOp:              "limit",
-	topKOp:               "top-k",
-	max1RowOp:            "max1row",
-	projectSetOp:         "project set",
-	windowOp:             "window",
-	insertOp:             "insert",
-	updateOp:             "update",
-	upsertOp:             "upsert",
-	deleteOp:             "delete",
-	deleteRangeOp:        "delete range",
-	errorIfRowsOp:        "error if rows",
-	bufferOp:             "buffer",
-	scanBufferOp:         "scan buffer",
-	recursiveCTEOp:       "recursive cte",
+	scanOp:                 "scan",
+	valuesOp:               "values",
+	filterOp:               "filter",
+	invertedFilterOp:       "inverted filter",
+	simpleProjectOp:        "simple project",
+	serializingProjectOp:   "serializing project",
+	renderOp:               "render",
+	applyJoinOp:            "apply join",
+	hashJoinOp:             "hash join",
+	mergeJoinOp:            "merge join",
+	groupByOp:              "group by",
+	scalarGroupByOp:        "scalar group by",
+	distinctOp:             "distinct",
+	hashSetOpOp:            "hash set op",
+	streamingSetOpOp:       "streaming set op",
+	unionAllOp:             "union all",
+	sortOp:                 "sort",
+	ordinalityOp:           "ordinality",
+	indexJoinOp:            "index join",
+	lookupJoinOp:           "lookup join",
+	invertedJoinOp:         "inverted join",
+	zigzagJoinOp:           "zigzag join",
+	limitOp:                "limit",
+	topKOp:                 "top-k",
+	max1RowOp:              "max1row",
+	projectSetOp:           "project set",
+	windowOp:               "window",
+	explainOptOp:           "explain (opt)",
+	explainOp:              "explain",
+	insertOp:               "insert",
+	updateOp:               "update",
+	upsertOp:               "upsert",
+	deleteOp:               "delete",
+	deleteRangeOp:          "delete range",
+	createTableOp:          "create table",
+	createTableAsOp:        "create table as",
+	sequenceSelectOp:       "sequence select",
+	saveTableOp:            "save table",
+	errorIfRowsOp:          "error if rows",
+	opaqueOp:               "opaque",
+	showTraceOp:            "show trace",
+	showCompletionsOp:      "show completions",
+	exportOp:               "export",
+	createFunctionOp:       "create function",
+	createViewOp:           "create view",
+	createTriggerOp:        "create trigger",
+	callOp:                 "call",
+	bufferOp:               "buffer",
+	scanBufferOp:           "scan buffer",
+	alterTableSplitOp:      "split",
+	alterTableUnsplitOp:    "unsplit",
+	alterTableUnsplitAllOp: "unsplit all",
+	alterTableRelocateOp:   "relocate table",
+	recursiveCTEOp:         "recursive cte",
+	controlJobsOp:          "control jobs",
+	controlSchedulesOp:     "control schedules",
+	cancelQueriesOp:        "cancel queries",
+	cancelSessionsOp:       "cancel sessions",
+}
+
+// opName returns the human-readable name of op, falling back to its numeric
+// code for operators without a name.
+func opName(op execOperator) string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("op_%d", op)
+}
+
+// opCodes maps operator names back to their codes.
+var opCodes = func() map[string]execOperator {
+	codes := make(map[string]execOperator, len(opNames))
+	for op, name := range opNames {
+		codes[name] = op
+	}
+	return codes
+}()
+
+// OperatorName returns the human-readable name of the operator with the given
+// code, as shown by FormatPlan (e.g. "hash join"). Codes without a name are
+// returned as "op_N".
+func OperatorName(code byte) string {
+	return opName(execOperator(code))
+}
+
+// OperatorCode returns the code of the operator with the given name, the
+// inverse of OperatorName for named operators. It reports false for names no
+// operator has, including the "op_N" fallback OperatorName returns for
+// unnamed codes.
+func OperatorCode(name string) (byte, bool) {
+	op, ok := opCodes[name]
+	return byte(op), ok
+}
+
+// opCategories maps operator codes to the broad category the operator
+// belongs to, as returned by Category. Category looks operators up by name,
+// so only operators in opNames are listed.
+var opCategories = map[execOperator]string{
+	scanOp:                 "scan",
+	valuesOp:               "scan",
+	scanBufferOp:           "scan",
+	sequenceSelectOp:       "scan",
+	applyJoinOp:            "join",
+	hashJoinOp:             "join",
+	mergeJoinOp:            "join",
+	indexJoinOp:            "join",
+	lookupJoinOp:           "join",
+	invertedJoinOp:         "join",
+	zigzagJoinOp:           "join",
+	insertOp:               "mutation",
+	updateOp:               "mutation",
+	upsertOp:               "mutation",
+	deleteOp:               "mutation",
+	deleteRangeOp:          "mutation",
+	groupByOp:              "aggregation",
+	scalarGroupByOp:        "aggregation",
+	distinctOp:             "aggregation",
+	windowOp:               "aggregation",
+	hashSetOpOp:            "set-op",
+	streamingSetOpOp:       "set-op",
+	unionAllOp:             "set-op",
+	createTableOp:          "ddl",
+	createTableAsOp:        "ddl",
+	createViewOp:           "ddl",
+	createFunctionOp:       "ddl",
+	createTriggerOp:        "ddl",
+	alterTableSplitOp:      "ddl",
+	alterTableUnsplitOp:    "ddl",
+	alterTableUnsplitAllOp: "ddl",
+	alterTableRelocateOp:   "ddl",
+	controlJobsOp:          "control",
+	controlSchedulesOp:     "control",
+	cancelQueriesOp:        "control",
+	cancelSessionsOp:       "control",
+	filterOp:               "util",
+	invertedFilterOp:       "util",
+	simpleProjectOp:        "util",
+	serializingProjectOp:   "util",
+	renderOp:               "util",
+	sortOp:                 "util",
+	ordinalityOp:           "util",
+	limitOp:                "util",
+	topKOp:                 "util",
+	max1RowOp:              "util",
+	projectSetOp:           "util",
+	explainOptOp:           "util",
+	explainOp:              "util",
+	showTraceOp:            "util",
+	showCompletionsOp:      "util",
+	saveTableOp:            "util",
+	errorIfRowsOp:          "util",
+	opaqueOp:               "util",
+	bufferOp:               "util",
+	recursiveCTEOp:         "util",
+	exportOp:               "util",
+	callOp:                 "util",
+}
+
+// Category returns the category of the operator with the given name, as
+// shown by FormatPlan, so tools can reason about plans generically (e.g.
+// "this plan contains a mutation"). The categories are:
+//   - "scan": operators that produce rows from storage or constants
+//   - "join": operators that combine two inputs or look up rows by key
+//   - "mutation": inserts, updates, upserts, and deletes
+//   - "aggregation": grouping, distinct, and window functions
+//   - "set-op": UNION, INTERSECT, and EXCEPT
+//   - "ddl": schema changes and range administration
+//   - "control": job, schedule, query, and session control
+//   - "util": everything else, such as filters, sorts, and limits
+//
+// Names no operator has return "".
+func Category(op string) string {
+	code, ok := opCodes[op]
+	if !ok {
+		return ""
+	}
+	return opCategories[code]
+}
+
+// isJoinOp reports whether op combines rows from two relations.
+func isJoinOp(op execOperator) bool {
+	switch op {
+	case applyJoinOp, hashJoinOp, mergeJoinOp, lookupJoinOp, invertedJoinOp, zigzagJoinOp:
+		return true
+	}
+	return false
+}
+
+// isProjectionOp reports whether op is a column projection that FormatPlan
+// collapses into its input.
+func isProjectionOp(op execOperator) bool {
+	return op == simpleProjectOp || op == serializingProjectOp
 }
@@ -0,0 +1,69 @@
+package gistdecoder
+
+import "testing"
+
+func TestOperatorNameAndCodeRoundTrip(t *testing.T) {
+	for op, name := range opNames {
+		if got := OperatorName(byte(op)); got != name {
+			t.Errorf("Expected OperatorName(%d) to be %q, got %q", op, name, got)
+		}
+		code, ok := OperatorCode(name)
+		if !ok {
+			t.Errorf("Expected OperatorCode(%q) to be found", name)
+			continue
+		}
+		if code != byte(op) {
+			t.Errorf("Expected OperatorCode(%q) to be %d, got %d", name, op, code)
+		}
+	}
+}
+
+func TestOperatorNameUnnamed(t *testing.T) {
+	if got := OperatorName(200); got != "op_200" {
+		t.Errorf("Expected op_200, got %q", got)
+	}
+	if _, ok := OperatorCode("op_200"); ok {
+		t.Error("Expected no code for an unnamed operator")
+	}
+	if _, ok := OperatorCode(OperatorName(byte(literalValuesOp))); ok {
+		t.Error("Expected no code for the op_N name of an unnamed operator")
+	}
+	if _, ok := OperatorCode("nested loop join"); ok {
+		t.Error("Expected no code for an unknown name")
+	}
+}
+
+func TestCategory(t *testing.T) {
+	tests := map[string]string{
+		"scan":           "scan",
+		"hash join":      "join",
+		"upsert":         "mutation",
+		"group by":       "aggregation",
+		"union all":      "set-op",
+		"create table":   "ddl",
+		"cancel queries": "control",
+		"sort":           "util",
+		"not an op":      "",
+	}
+	for op, expected := range tests {
+		if got := Category(op); got != expected {
+			t.Errorf("Expected Category(%q) to be %q, got %q", op, expected, got)
+		}
+	}
+}
+
+func TestCategoryCoversNamedOperators(t *testing.T) {
+	for op, name := range opNames {
+		if Category(name) == "" {
+			t.Errorf("Expected a category for %s (code %d)", name, op)
+		}
+	}
+}
+
+func TestCategoryOnlyNamedOperators(t *testing.T) {
+	for op := range opCategories {
+		if _, ok := opNames[op]; !ok {
+			t.Errorf("Expected category entry for code %d to have a name", op)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package gistdecoder
+
+// DefaultMaxNodes is the maximum number of operators decoded from a single
+// gist unless overridden with WithMaxNodes. Real plans are far smaller; the
+// limit guards against crafted gists that encode huge operator sequences.
+const DefaultMaxNodes = 10000
+
+// DecodeOption configures how a gist is decoded.
+type DecodeOption func(*decodeConfig)
+
+// decodeConfig holds the settings applied by DecodeOptions.
+type decodeConfig struct {
+	maxNodes   int
+	minVersion int
+	maxVersion int
+}
+
+// defaultDecodeConfig returns the configuration used when no options are
+// given.
+func defaultDecodeConfig() decodeConfig {
+	return decodeConfig{
+		maxNodes:   DefaultMaxNodes,
+		minVersion: gistVersion,
+		maxVersion: gistVersion,
+	}
+}
+
+// WithMaxNodes sets the maximum number of operators that may be decoded from
+// a gist; decoding a gist with more operators fails with
+// ErrMaxNodesExceeded. A value of zero or less disables the limit.
+func WithMaxNodes(n int) DecodeOption {
+	return func(c *decodeConfig) {
+		c.maxNodes = n
+	}
+}
+
+// WithMinVersion sets the oldest gist version that will be decoded; gists
+// with an older version header fail with ErrUnsupportedVersion. Versions
+// below 1 are never valid.
+func WithMinVersion(v int) DecodeOption {
+	return func(c *decodeConfig) {
+		c.minVersion = v
+	}
+}
+
+// WithMaxVersion sets the newest gist version that will be decoded; gists
+// with a newer version header fail with ErrUnsupportedVersion. By default
+// only the latest version the decoder knows is accepted. Raising the limit
+// decodes newer gists with that version's layout, which is only correct if
+// the newer encoding made additive changes.
+func WithMaxVersion(v int) DecodeOption {
+	return func(c *decodeConfig) {
+		c.maxVersion = v
+	}
+}
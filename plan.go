@@ -0,0 +1,55 @@
+package gistdecoder
+
+// Plan is a decoded gist along with plan-level metadata that doesn't belong
+// to any one node.
+type Plan struct {
+	// Root is the main plan, without the constraint checks.
+	Root *Node
+	// Version is the gist encoding version from the gist's header.
+	Version int
+	// Checks holds the error if rows subtree of each constraint check run
+	// after the main plan, such as foreign key checks of a mutation.
+	Checks []*Node
+}
+
+// DecodePlan decodes a base64-encoded plan gist into a Plan. Table and index
+// IDs are shown as numbers; use DecodePlanGist to resolve them to names.
+func DecodePlan(gist string, opts ...DecodeOption) (*Plan, error) {
+	d := getDecoder(nil, nil, opts)
+	defer d.release()
+	tree, err := d.decodeGist(gist)
+	if err != nil {
+		return nil, err
+	}
+	root, checks := tree.Unwrap()
+	return &Plan{Root: root, Version: d.version, Checks: checks}, nil
+}
+
+// tree returns the plan as a single tree, placing the main plan and its
+// checks under the same root that DecodePlanGist returns.
+func (p *Plan) tree() *Node {
+	if len(p.Checks) == 0 {
+		return p.Root
+	}
+	return &Node{
+		op:       unknownOp,
+		args:     map[string]interface{}{"checks": len(p.Checks)},
+		children: append([]*Node{p.Root}, p.Checks...),
+	}
+}
+
+// Format formats the plan, including its constraint checks, like FormatPlan.
+func (p *Plan) Format() string {
+	return FormatPlan(p.tree())
+}
+
+// JSON formats the plan, including its constraint checks, like PlanToJSON.
+func (p *Plan) JSON() ([]byte, error) {
+	return PlanToJSON(p.tree())
+}
+
+// Fingerprint hashes the shape of the plan, including its constraint checks,
+// like PlanFingerprint.
+func (p *Plan) Fingerprint() uint64 {
+	return PlanFingerprint(p.tree())
+}
@@ -0,0 +1,77 @@
+package gistdecoder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodePlan(t *testing.T) {
+	gist := "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"
+
+	plan, err := DecodePlan(gist)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if plan.Version != gistVersion {
+		t.Errorf("Expected version %d, got %d", gistVersion, plan.Version)
+	}
+	if len(plan.Checks) != 0 {
+		t.Errorf("Expected no checks, got %d", len(plan.Checks))
+	}
+	if plan.Root == nil || plan.Root.op != updateOp {
+		t.Fatalf("Expected an update at the root, got %v", plan.Root)
+	}
+
+	node := mustDecode(t, gist)
+	if got := plan.Format(); got != FormatPlan(node) {
+		t.Errorf("Expected Format to match FormatPlan, got:\n%s", got)
+	}
+	if plan.Fingerprint() != PlanFingerprint(node) {
+		t.Error("Expected Fingerprint to match PlanFingerprint")
+	}
+	planJSON, err := plan.JSON()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nodeJSON, _ := PlanToJSON(node)
+	if !bytes.Equal(planJSON, nodeJSON) {
+		t.Errorf("Expected JSON to match PlanToJSON, got:\n%s", planJSON)
+	}
+}
+
+func TestDecodePlanChecks(t *testing.T) {
+	// INSERT INTO child VALUES (1, 2), with a foreign key check into parent.
+	gist := newGistBuilder().
+		op(valuesOp).int(1).int(2).
+		op(bufferOp).int(1).
+		op(insertOp).int(113).intSet(0, 1).emptyIntSet().emptyIntSet().bool(false).
+		op(scanBufferOp).int(1).
+		op(lookupJoinOp).byte(5).int(112).int(1).int(1).bool(true).
+		op(errorIfRowsOp).
+		String()
+
+	plan, err := DecodePlan(gist)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if plan.Root == nil || plan.Root.op != insertOp {
+		t.Fatalf("Expected the insert as the main plan, got %v", plan.Root)
+	}
+	if len(plan.Checks) != 1 || plan.Checks[0].op != errorIfRowsOp {
+		t.Fatalf("Expected a single error if rows check, got %v", plan.Checks)
+	}
+
+	node := mustDecode(t, gist)
+	if got := plan.Format(); got != FormatPlan(node) {
+		t.Errorf("Expected Format to include the checks like FormatPlan, got:\n%s", got)
+	}
+	if plan.Fingerprint() != PlanFingerprint(node) {
+		t.Error("Expected Fingerprint to cover the checks")
+	}
+}
+
+func TestDecodePlanError(t *testing.T) {
+	if _, err := DecodePlan("not-valid-base64!"); err == nil {
+		t.Error("Expected error for invalid base64")
+	}
+}
@@ -0,0 +1,57 @@
+package gistdecoder
+
+import "fmt"
+
+// tableKey identifies an index by its table and index IDs, since index IDs
+// are only unique within a table.
+type tableKey struct {
+	table, index int64
+}
+
+// Redact returns a copy of the plan rooted at n with table, index, and
+// sequence IDs and names replaced by placeholders, so the plan's shape can
+// be shared without revealing the schema. Tables are named t1, t2, and so
+// on, indexes idx1, idx2, and sequences seq1, seq2, numbered in the order
+// Walk first reaches them, and the IDs are replaced by the same numbers.
+// The same table or index always gets the same placeholder, so joins of a
+// table with itself remain recognizable. n itself is not modified.
+func Redact(n *Node) *Node {
+	redacted := n.Clone()
+	tables := make(map[int64]int64)
+	indexes := make(map[tableKey]int64)
+	sequences := make(map[int64]int64)
+	placeholder := func(ids map[int64]int64, id int64) int64 {
+		if p, ok := ids[id]; ok {
+			return p
+		}
+		p := int64(len(ids) + 1)
+		ids[id] = p
+		return p
+	}
+
+	Walk(redacted, func(node *Node) bool {
+		tableID, hasTable := node.args["table_id"].(int64)
+		if hasTable {
+			t := placeholder(tables, tableID)
+			node.args["table_id"] = t
+			node.args["table"] = fmt.Sprintf("t%d", t)
+		}
+		if indexID, ok := node.args["index_id"].(int64); ok && hasTable {
+			key := tableKey{tableID, indexID}
+			i, ok := indexes[key]
+			if !ok {
+				i = int64(len(indexes) + 1)
+				indexes[key] = i
+			}
+			node.args["index_id"] = i
+			node.args["index"] = fmt.Sprintf("idx%d", i)
+		}
+		if seqID, ok := node.args["sequence_id"].(int64); ok {
+			s := placeholder(sequences, seqID)
+			node.args["sequence_id"] = s
+			node.args["sequence"] = fmt.Sprintf("seq%d", s)
+		}
+		return true
+	})
+	return redacted
+}
@@ -0,0 +1,58 @@
+package gistdecoder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	// A self-join of users through its primary key, joined with orders
+	// through a secondary index.
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		scan(112, 1, 1, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		op(lookupJoinOp).byte(0).int(113).int(2).int(1).bool(false).
+		String()
+	lookup := func(id int64) string { return map[int64]string{112: "users", 113: "orders"}[id] }
+	original, err := DecodePlanGist(gist, lookup, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := FormatPlan(original)
+
+	redacted := Redact(original)
+	if FormatPlan(original) != before {
+		t.Error("Expected Redact to leave the original plan unchanged")
+	}
+
+	join := redacted.children[0]
+	for i, scan := range []*Node{join.children[0], join.children[1]} {
+		if scan.args["table"] != "t2" || scan.args["table_id"] != int64(2) {
+			t.Errorf("Expected scan %d of users to be t2, got %v", i, scan.args)
+		}
+		if scan.args["index"] != "idx2" || scan.args["index_id"] != int64(2) {
+			t.Errorf("Expected scan %d of the users primary key to be idx2, got %v", i, scan.args)
+		}
+	}
+	// The lookup join at the root is reached first.
+	if redacted.args["table"] != "t1" || redacted.args["index"] != "idx1" {
+		t.Errorf("Expected the lookup into orders to be t1@idx1, got %v", redacted.args)
+	}
+
+	output := FormatPlan(redacted)
+	for _, leaked := range []string{"users", "orders", "112", "113"} {
+		if strings.Contains(output, leaked) {
+			t.Errorf("Expected %q to be redacted, got:\n%s", leaked, output)
+		}
+	}
+	if PlanFingerprint(redacted) != PlanFingerprint(original) {
+		t.Error("Expected redaction to preserve the plan's structure")
+	}
+}
+
+func TestRedactNil(t *testing.T) {
+	if Redact(nil) != nil {
+		t.Error("Expected redacting a nil plan to return nil")
+	}
+}
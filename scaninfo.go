@@ -0,0 +1,42 @@
+package gistdecoder
+
+// ScanInfo holds the decoded arguments of a scan node, so callers don't
+// have to type-assert the entries of its arguments.
+type ScanInfo struct {
+	TableID   int64
+	IndexID   int64
+	TableName string
+	IndexName string
+	// NeededCols is the number of table columns the scan fetches.
+	NeededCols int
+	// IndexConstraint is set when an index constraint restricts the scan to
+	// one or more spans.
+	IndexConstraint bool
+	// InvertedConstraint is set when an inverted index constraint restricts
+	// the scan.
+	InvertedConstraint bool
+	// FullScan is set when neither constraint restricts the scan.
+	FullScan bool
+	// HardLimit is set when the scan reads a limited number of rows.
+	HardLimit bool
+}
+
+// ScanInfo returns the arguments of n if it is a scan, and reports whether
+// it is.
+func (n *Node) ScanInfo() (*ScanInfo, bool) {
+	if n == nil || n.op != scanOp {
+		return nil, false
+	}
+	info := &ScanInfo{
+		TableName:          stringArg(n, "table"),
+		IndexName:          stringArg(n, "index"),
+		NeededCols:         intArg(n, "needed_cols"),
+		IndexConstraint:    boolArg(n, "index_constraint"),
+		InvertedConstraint: boolArg(n, "inverted_constraint"),
+		FullScan:           boolArg(n, "full_scan"),
+		HardLimit:          boolArg(n, "hard_limit"),
+	}
+	info.TableID, _ = n.args["table_id"].(int64)
+	info.IndexID, _ = n.args["index_id"].(int64)
+	return info, true
+}
@@ -0,0 +1,50 @@
+package gistdecoder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanInfo(t *testing.T) {
+	// SELECT a, b FROM users WHERE id > 10 LIMIT 5
+	gist := newGistBuilder().op(scanOp).int(112).int(1).intSet(0, 1).int(1).int(0).int(1).String()
+	tableLookup := func(id int64) string { return "users" }
+	indexLookup := func(tableID, indexID int64) string { return "users_pkey" }
+	node, err := DecodePlanGist(gist, tableLookup, indexLookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, ok := node.ScanInfo()
+	if !ok {
+		t.Fatal("Expected scan info for a scan")
+	}
+	expected := &ScanInfo{
+		TableID:         112,
+		IndexID:         1,
+		TableName:       "users",
+		IndexName:       "users_pkey",
+		NeededCols:      2,
+		IndexConstraint: true,
+		HardLimit:       true,
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, info)
+	}
+
+	info, _ = mustDecode(t, newGistBuilder().scan(112, 1, 0, 0, 0).String()).ScanInfo()
+	if !info.FullScan || info.IndexConstraint {
+		t.Errorf("Expected an unconstrained full scan, got %+v", info)
+	}
+}
+
+func TestScanInfoNotAScan(t *testing.T) {
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+	if info, ok := node.ScanInfo(); ok || info != nil {
+		t.Errorf("Expected no scan info for %s, got %+v", opName(node.op), info)
+	}
+	var n *Node
+	if _, ok := n.ScanInfo(); ok {
+		t.Error("Expected no scan info for a nil node")
+	}
+}
@@ -0,0 +1,54 @@
+package gistdecoder
+
+// PlanStats holds scalar measures of a plan's size and shape. Like
+// Summarize, the counts cover the operators FormatPlan shows, so collapsed
+// projections are neither counted nor add to the depth.
+type PlanStats struct {
+	// NodeCount is the number of operators in the plan.
+	NodeCount int
+	// MaxDepth is the number of operators on the longest path from the root
+	// to a leaf; a plan with a single operator has depth 1.
+	MaxDepth int
+	// JoinCount is the number of join operators of any kind.
+	JoinCount int
+	// ScanCount is the number of scan operators.
+	ScanCount int
+	// FullScanCount is the number of scans with no span constraint.
+	FullScanCount int
+}
+
+// Stats computes PlanStats for the plan rooted at n in a single traversal.
+// A nil plan has zero stats, and a plan with constraint checks counts the
+// operators of the main plan and of every check.
+func Stats(n *Node) PlanStats {
+	var s PlanStats
+	var visit func(n *Node, depth int)
+	visit = func(n *Node, depth int) {
+		if n == nil {
+			return
+		}
+		// The synthetic root above a plan's constraint checks is not an
+		// operator of the plan.
+		if !isProjectionOp(n.op) && !isChecksWrapper(n) {
+			depth++
+			s.NodeCount++
+			if depth > s.MaxDepth {
+				s.MaxDepth = depth
+			}
+			if isJoinOp(n.op) {
+				s.JoinCount++
+			}
+			if n.op == scanOp {
+				s.ScanCount++
+			}
+			if isFullScan(n) {
+				s.FullScanCount++
+			}
+		}
+		for _, child := range n.children {
+			visit(child, depth)
+		}
+	}
+	visit(n, 0)
+	return s
+}
@@ -0,0 +1,57 @@
+package gistdecoder
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		gist     string
+		expected PlanStats
+	}{
+		{
+			// scan → render → simple project → update; the projection is
+			// collapsed.
+			name:     "update",
+			gist:     "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM",
+			expected: PlanStats{NodeCount: 3, MaxDepth: 3, ScanCount: 1},
+		},
+		{
+			name: "join",
+			gist: newGistBuilder().
+				scan(112, 1, 0, 0, 0).
+				scan(113, 1, 1, 0, 0).
+				op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+				op(filterOp).
+				scan(114, 1, 0, 0, 0).
+				op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+				op(renderOp).int(2).
+				String(),
+			expected: PlanStats{NodeCount: 7, MaxDepth: 5, JoinCount: 2, ScanCount: 3, FullScanCount: 2},
+		},
+		{
+			// An insert with one check; the synthetic root above them is
+			// not counted.
+			name: "checks",
+			gist: newGistBuilder().
+				op(valuesOp).int(1).int(2).
+				op(insertOp).int(113).intSet(0, 1).emptyIntSet().emptyIntSet().bool(false).
+				scan(112, 1, 1, 0, 0).
+				op(errorIfRowsOp).
+				String(),
+			expected: PlanStats{NodeCount: 4, MaxDepth: 2, ScanCount: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Stats(mustDecode(t, tt.gist)); got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStatsNil(t *testing.T) {
+	if got := Stats(nil); got != (PlanStats{}) {
+		t.Errorf("Expected zero stats for a nil plan, got %+v", got)
+	}
+}
@@ -0,0 +1,60 @@
+package gistdecoder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// summaryNodes returns the nodes of the tree rooted at n in post-order
+// (inputs before the operators consuming them), skipping the projections
+// that FormatPlan collapses.
+func summaryNodes(n *Node) []*Node {
+	var nodes []*Node
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		if n == nil {
+			return
+		}
+		for _, child := range n.children {
+			visit(child)
+		}
+		if !isProjectionOp(n.op) {
+			nodes = append(nodes, n)
+		}
+	}
+	visit(n)
+	return nodes
+}
+
+// summaryLabel returns the operator name of n followed by its most salient
+// argument in parentheses: the join type for joins, or the table for scans,
+// index joins, and mutations.
+func summaryLabel(n *Node) string {
+	name := planOpName(n)
+	if isJoinOp(n.op) {
+		if jt, ok := n.args["type"]; ok {
+			return fmt.Sprintf("%s(%v)", name, jt)
+		}
+		return name
+	}
+	if table, ok := n.args["table"]; ok {
+		return fmt.Sprintf("%s(%v)", name, table)
+	}
+	return name
+}
+
+// Summarize returns a compact single-line summary of a plan, listing the
+// operators depth-first with inputs before the operators that consume them.
+// Trivial projections are skipped, as in FormatPlan.
+//
+// Example output:
+//
+//	scan(users)→filter→hash join(inner)→render
+func Summarize(n *Node) string {
+	nodes := summaryNodes(n)
+	labels := make([]string, len(nodes))
+	for i, node := range nodes {
+		labels[i] = summaryLabel(node)
+	}
+	return strings.Join(labels, "→")
+}
@@ -0,0 +1,58 @@
+package gistdecoder
+
+import "testing"
+
+func TestSummarize(t *testing.T) {
+	node, err := DecodePlanGist("AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	if got, want := Summarize(node), "scan(112)→render→update(112)"; got != want {
+		t.Errorf("Expected summary %q, got %q", want, got)
+	}
+}
+
+func TestSummarizeJoin(t *testing.T) {
+	gist := newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(filterOp).
+		scan(113, 1, 1, 0, 0).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		op(renderOp).int(2).
+		String()
+
+	tableLookup := func(id int64) string {
+		if id == 112 {
+			return "users"
+		}
+		return ""
+	}
+
+	node, err := DecodePlanGist(gist, tableLookup, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	if got, want := Summarize(node), "scan(users)→filter→scan(113)→hash join(inner)→render"; got != want {
+		t.Errorf("Expected summary %q, got %q", want, got)
+	}
+}
+
+func TestSummarizeChecks(t *testing.T) {
+	node := mustDecode(t, newGistBuilder().
+		op(valuesOp).int(1).int(2).
+		op(insertOp).int(113).intSet(0, 1).emptyIntSet().emptyIntSet().bool(false).
+		scan(112, 1, 1, 0, 0).
+		op(errorIfRowsOp).
+		String())
+	if got, want := Summarize(node), "values→insert(113)→scan(112)→error if rows→root"; got != want {
+		t.Errorf("Expected summary %q, got %q", want, got)
+	}
+}
+
+func TestSummarizeNilNode(t *testing.T) {
+	if got := Summarize(nil); got != "" {
+		t.Errorf("Expected empty summary for nil node, got %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+package gistdecoder
+
+import "sort"
+
+// expectedAttributes lists the argument keys that the decoder always records
+// for each operator. Operators that are not listed have no required arguments.
+var expectedAttributes = map[execOperator][]string{
+	scanOp:                 {"table", "index", "table_id", "index_id", "needed_cols", "full_scan"},
+	valuesOp:               {"rows", "columns"},
+	renderOp:               {"columns"},
+	applyJoinOp:            {"type", "correlated"},
+	hashJoinOp:             {"type", "left_eq_cols", "right_eq_cols"},
+	mergeJoinOp:            {"type", "left_eq_cols", "right_eq_cols"},
+	groupByOp:              {"group_cols", "ordered"},
+	hashSetOpOp:            {"strategy"},
+	streamingSetOpOp:       {"strategy"},
+	topKOp:                 {"k"},
+	indexJoinOp:            {"table", "table_id", "key_cols"},
+	lookupJoinOp:           {"type", "table", "index", "table_id", "index_id", "equality_cols"},
+	invertedJoinOp:         {"type", "table", "index", "table_id", "index_id"},
+	insertOp:               {"table", "table_id", "insert_cols", "return_cols", "check_cols", "has_returning", "auto_commit"},
+	updateOp:               {"table", "table_id"},
+	deleteOp:               {"table", "table_id", "fetch_cols", "return_cols", "has_returning", "auto_commit"},
+	upsertOp:               {"table", "table_id", "insert_cols", "fetch_cols", "update_cols", "return_cols", "check_cols", "has_returning", "auto_commit"},
+	createTableOp:          {"schema_id"},
+	createTableAsOp:        {"schema_id"},
+	createFunctionOp:       {"schema_id"},
+	createViewOp:           {"schema_id", "columns"},
+	exportOp:               {"not_null_cols"},
+	alterTableSplitOp:      {"table", "index", "table_id", "index_id"},
+	alterTableUnsplitOp:    {"table", "index", "table_id", "index_id"},
+	alterTableUnsplitAllOp: {"table", "index", "table_id", "index_id"},
+	alterTableRelocateOp:   {"table", "index", "table_id", "index_id"},
+	sequenceSelectOp:       {"sequence", "sequence_id"},
+	bufferOp:               {"buffer_id"},
+	scanBufferOp:           {"buffer_id"},
+	recursiveCTEOp:         {"deduplicate"},
+}
+
+// Walk visits n and its descendants in pre-order, including the projections
+// that FormatPlan collapses. If fn returns false, the children of the current
+// node are not visited. Nil nodes are skipped.
+func Walk(n *Node, fn func(*Node) bool) {
+	if n == nil {
+		return
+	}
+	if !fn(n) {
+		return
+	}
+	for _, child := range n.children {
+		Walk(child, fn)
+	}
+}
+
+// MissingAttributes reports, for every node in the tree rooted at n, the
+// expected argument keys that are absent from the node's arguments. Nodes
+// with all of their expected arguments present are omitted from the result.
+//
+// This is a QA aid for the decoder itself: a non-empty result usually means
+// an operator body was only partially decoded.
+func MissingAttributes(n *Node) map[*Node][]string {
+	missing := make(map[*Node][]string)
+	Walk(n, func(node *Node) bool {
+		var keys []string
+		for _, key := range expectedAttributes[node.op] {
+			if _, ok := node.args[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			missing[node] = keys
+		}
+		return true
+	})
+	return missing
+}
@@ -0,0 +1,43 @@
+package gistdecoder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingAttributes(t *testing.T) {
+	scan := &Node{
+		op: scanOp,
+		args: map[string]interface{}{
+			"index":       "1",
+			"table_id":    int64(112),
+			"index_id":    int64(1),
+			"needed_cols": 2,
+			"full_scan":   true,
+		},
+	}
+	root := &Node{
+		op:       renderOp,
+		args:     map[string]interface{}{"columns": 2},
+		children: []*Node{scan},
+	}
+
+	missing := MissingAttributes(root)
+	if len(missing) != 1 {
+		t.Fatalf("Expected 1 node with missing attributes, got %d: %v", len(missing), missing)
+	}
+	if got := missing[scan]; !reflect.DeepEqual(got, []string{"table"}) {
+		t.Errorf("Expected scan to be missing [table], got %v", got)
+	}
+}
+
+func TestMissingAttributesDecodedPlan(t *testing.T) {
+	node, err := DecodePlanGist("AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	if missing := MissingAttributes(node); len(missing) != 0 {
+		t.Errorf("Expected no missing attributes for a fully decoded plan, got %v", missing)
+	}
+}
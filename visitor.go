@@ -0,0 +1,46 @@
+package gistdecoder
+
+// Visitor receives the nodes of a plan from Accept, one method per operator
+// category of Category: VisitScan for "scan" operators, which include values
+// and sequence selects as well as table scans, VisitJoin for "join",
+// VisitMutation for "mutation", and VisitOther for the rest. Embed
+// BaseVisitor to implement only the methods of interest.
+type Visitor interface {
+	VisitScan(*Node)
+	VisitJoin(*Node)
+	VisitMutation(*Node)
+	VisitOther(*Node)
+}
+
+// BaseVisitor implements Visitor with methods that do nothing.
+type BaseVisitor struct{}
+
+// VisitScan does nothing.
+func (BaseVisitor) VisitScan(*Node) {}
+
+// VisitJoin does nothing.
+func (BaseVisitor) VisitJoin(*Node) {}
+
+// VisitMutation does nothing.
+func (BaseVisitor) VisitMutation(*Node) {}
+
+// VisitOther does nothing.
+func (BaseVisitor) VisitOther(*Node) {}
+
+// Accept passes each node of the plan rooted at root to the method of v for
+// its operator's category, in the pre-order of Walk.
+func Accept(root *Node, v Visitor) {
+	Walk(root, func(n *Node) bool {
+		switch opCategories[n.op] {
+		case "scan":
+			v.VisitScan(n)
+		case "join":
+			v.VisitJoin(n)
+		case "mutation":
+			v.VisitMutation(n)
+		default:
+			v.VisitOther(n)
+		}
+		return true
+	})
+}
@@ -0,0 +1,64 @@
+package gistdecoder
+
+import "testing"
+
+// countingVisitor counts scans and joins, leaving other nodes to BaseVisitor.
+type countingVisitor struct {
+	BaseVisitor
+	scans, joins []string
+}
+
+func (v *countingVisitor) VisitScan(n *Node) {
+	v.scans = append(v.scans, opName(n.op))
+}
+
+func (v *countingVisitor) VisitJoin(n *Node) {
+	v.joins = append(v.joins, opName(n.op))
+}
+
+func TestAccept(t *testing.T) {
+	// A hash join of a scan and a lookup join of values, under a filter.
+	node := mustDecode(t, newGistBuilder().
+		scan(112, 1, 1, 0, 0).
+		op(valuesOp).int(1).int(1).
+		op(lookupJoinOp).byte(0).int(113).int(1).int(1).bool(true).
+		op(hashJoinOp).byte(0).int(1).int(1).bool(false).bool(false).
+		op(filterOp).String())
+
+	v := &countingVisitor{}
+	Accept(node, v)
+	if len(v.scans) != 2 || v.scans[0] != "scan" || v.scans[1] != "values" {
+		t.Errorf("Expected to visit a scan and values, got %v", v.scans)
+	}
+	if len(v.joins) != 2 || v.joins[0] != "hash join" || v.joins[1] != "lookup join" {
+		t.Errorf("Expected to visit a hash join then a lookup join, got %v", v.joins)
+	}
+
+	Accept(nil, v)
+	if len(v.scans) != 2 || len(v.joins) != 2 {
+		t.Errorf("Expected a nil plan to visit nothing, got %v and %v", v.scans, v.joins)
+	}
+}
+
+func TestAcceptMutation(t *testing.T) {
+	var mutations, other int
+	v := &funcVisitor{
+		mutation: func(*Node) { mutations++ },
+		other:    func(*Node) { other++ },
+	}
+	// update -> simple project -> render -> scan
+	Accept(mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM"), v)
+	if mutations != 1 || other != 2 {
+		t.Errorf("Expected 1 mutation and 2 other nodes, got %d and %d", mutations, other)
+	}
+}
+
+// funcVisitor calls the functions it holds for mutations and other nodes.
+type funcVisitor struct {
+	BaseVisitor
+	mutation, other func(*Node)
+}
+
+func (v *funcVisitor) VisitMutation(n *Node) { v.mutation(n) }
+
+func (v *funcVisitor) VisitOther(n *Node) { v.other(n) }
@@ -0,0 +1,74 @@
+package gistdecoder
+
+import "fmt"
+
+// Warnings runs the plan heuristics over the tree and returns a list of
+// actionable warnings, each naming the operator and the reason it was
+// flagged. The checks are:
+//   - full scans of a table or index
+//   - cross joins (joins without equality columns)
+//   - redundant sorts (a sort of the output of another sort)
+//   - lookup joins driven by a full scan
+//   - sorts of a full scan with no limit in between
+//
+// Warnings are returned in pre-order; a clean plan yields none.
+func Warnings(n *Node) []string {
+	sortsAfterFullScan := make(map[*Node]bool)
+	for _, sortNode := range SortAfterFullScan(n) {
+		sortsAfterFullScan[sortNode] = true
+	}
+
+	var warnings []string
+	warn := func(node *Node, format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf("%s: %s", opName(node.op), fmt.Sprintf(format, args...)))
+	}
+
+	Walk(n, func(node *Node) bool {
+		if isFullScan(node) {
+			warn(node, "full scan of %v@%v", node.args["table"], node.args["index"])
+		}
+		if isCrossJoin(node) {
+			warn(node, "cross join with no equality columns")
+		}
+		if isRedundantSort(node) {
+			warn(node, "sorts the output of another sort")
+		}
+		if node.op == lookupJoinOp && len(node.children) > 0 && isFullScan(skipProjections(node.children[0])) {
+			warn(node, "lookup into %v@%v is driven by a full scan", node.args["table"], node.args["index"])
+		}
+		if sortsAfterFullScan[node] {
+			warn(node, "sorts a full scan with no limit")
+		}
+		return true
+	})
+	return warnings
+}
+
+// isCrossJoin reports whether n is a join that decoded zero equality
+// columns, meaning every left row is paired with every right row.
+func isCrossJoin(n *Node) bool {
+	if !isJoinOp(n.op) {
+		return false
+	}
+	eqCols, ok := n.args["left_eq_cols"].(int)
+	return ok && eqCols == 0
+}
+
+// isRedundantSort reports whether n is a sort whose input is already the
+// output of a sort or top-k.
+func isRedundantSort(n *Node) bool {
+	if n.op != sortOp || len(n.children) == 0 {
+		return false
+	}
+	input := skipProjections(n.children[0])
+	return input != nil && (input.op == sortOp || input.op == topKOp)
+}
+
+// skipProjections returns the first descendant of n (or n itself) that is
+// not a collapsed projection.
+func skipProjections(n *Node) *Node {
+	for n != nil && isProjectionOp(n.op) && len(n.children) > 0 {
+		n = n.children[0]
+	}
+	return n
+}
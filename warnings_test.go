@@ -0,0 +1,46 @@
+package gistdecoder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWarningsFullScan(t *testing.T) {
+	node := mustDecode(t, newGistBuilder().scan(112, 1, 0, 0, 0).op(filterOp).String())
+
+	expected := []string{"scan: full scan of 112@1"}
+	if got := Warnings(node); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestWarningsCleanPlan(t *testing.T) {
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+
+	if got := Warnings(node); len(got) != 0 {
+		t.Errorf("Expected no warnings, got %v", got)
+	}
+}
+
+func TestWarningsAllDetectors(t *testing.T) {
+	node := mustDecode(t, newGistBuilder().
+		scan(112, 1, 0, 0, 0).
+		op(lookupJoinOp).byte(0).int(113).int(2).int(1).bool(false).
+		scan(114, 1, 1, 0, 0).
+		op(hashJoinOp).byte(0).int(0).int(0).bool(false).bool(false).
+		op(sortOp).
+		op(sortOp).
+		String())
+
+	expected := []string{
+		"sort: sorts the output of another sort",
+		"sort: sorts a full scan with no limit",
+		"sort: sorts a full scan with no limit",
+		"hash join: cross join with no equality columns",
+		"lookup join: lookup into 113@2 is driven by a full scan",
+		"scan: full scan of 112@1",
+	}
+	if got := Warnings(node); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,84 @@
+package gistdecoder
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PlanToYAML formats a decoded plan tree as a YAML document with the same
+// structure as PlanToJSON: each node is a mapping with "op", "args", and
+// "children" keys, for example:
+//
+//	op: "update"
+//	args:
+//	  table: "112"
+//	  table_id: 112
+//	children:
+//	  - op: "simple project"
+//	    ...
+//
+// The encoder is self-contained so the package stays free of a YAML
+// dependency. Argument keys are sorted and string values are always quoted.
+// A nil plan encodes as null.
+func PlanToYAML(n *Node) ([]byte, error) {
+	if n == nil {
+		return []byte("null\n"), nil
+	}
+	var sb strings.Builder
+	writeYAMLNode(&sb, n, "", "")
+	return []byte(sb.String()), nil
+}
+
+// writeYAMLNode writes n as a mapping. The first line is prefixed with first
+// (such as a sequence entry marker) and the remaining lines with indent.
+func writeYAMLNode(sb *strings.Builder, n *Node, first, indent string) {
+	sb.WriteString(fmt.Sprintf("%sop: %s\n", first, yamlString(planOpName(n))))
+
+	if len(n.args) > 0 {
+		sb.WriteString(indent + "args:\n")
+		keys := make([]string, 0, len(n.args))
+		for k := range n.args {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sb.WriteString(fmt.Sprintf("%s  %s: %s\n", indent, k, yamlScalar(n.args[k])))
+		}
+	}
+
+	if len(n.children) > 0 {
+		sb.WriteString(indent + "children:\n")
+		for _, child := range n.children {
+			if child == nil {
+				sb.WriteString(indent + "  - null\n")
+				continue
+			}
+			writeYAMLNode(sb, child, indent+"  - ", indent+"    ")
+		}
+	}
+}
+
+// yamlScalar formats an argument value as a YAML scalar.
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return yamlString(v)
+	default:
+		return yamlString(fmt.Sprint(v))
+	}
+}
+
+// yamlString formats s as a double-quoted YAML string.
+func yamlString(s string) string {
+	return strconv.Quote(s)
+}
@@ -0,0 +1,80 @@
+package gistdecoder
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// yamlOps extracts the operator names from PlanToYAML output along with their
+// nesting depth, derived from the indentation of each "op:" key.
+func yamlOps(t *testing.T, doc string) ([]string, []int) {
+	t.Helper()
+	var ops []string
+	var depths []int
+	for _, line := range strings.Split(doc, "\n") {
+		trimmed := strings.TrimLeft(line, " -")
+		if !strings.HasPrefix(trimmed, "op: ") {
+			continue
+		}
+		op, err := strconv.Unquote(strings.TrimPrefix(trimmed, "op: "))
+		if err != nil {
+			t.Fatalf("Failed to parse op in line %q: %v", line, err)
+		}
+		ops = append(ops, op)
+		depths = append(depths, (len(line)-len(trimmed))/4)
+	}
+	return ops, depths
+}
+
+func TestPlanToYAML(t *testing.T) {
+	node := mustDecode(t, "AgHgAQIA/wMCAAAHFAUUIeABAAAFDAYM")
+
+	b, err := PlanToYAML(node)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	doc := string(b)
+
+	ops, depths := yamlOps(t, doc)
+	if want := []string{"update", "simple project", "render", "scan"}; !reflect.DeepEqual(ops, want) {
+		t.Errorf("Expected ops %v, got %v\n%s", want, ops, doc)
+	}
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(depths, want) {
+		t.Errorf("Expected depths %v, got %v\n%s", want, depths, doc)
+	}
+
+	for _, expected := range []string{"args:\n  table: \"112\"\n  table_id: 112\n", "index_constraint: true", "full_scan: false"} {
+		if !strings.Contains(doc, expected) {
+			t.Errorf("Expected YAML to contain %q, got:\n%s", expected, doc)
+		}
+	}
+}
+
+func TestPlanToYAMLSiblings(t *testing.T) {
+	node := mustDecode(t, hashJoinGist(112, 113, 0))
+
+	b, err := PlanToYAML(node)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	ops, depths := yamlOps(t, string(b))
+	if want := []string{"hash join", "scan", "scan"}; !reflect.DeepEqual(ops, want) {
+		t.Errorf("Expected ops %v, got %v\n%s", want, ops, b)
+	}
+	if want := []int{0, 1, 1}; !reflect.DeepEqual(depths, want) {
+		t.Errorf("Expected depths %v, got %v\n%s", want, depths, b)
+	}
+}
+
+func TestPlanToYAMLNilNode(t *testing.T) {
+	b, err := PlanToYAML(nil)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if string(b) != "null\n" {
+		t.Errorf("Expected null, got %q", b)
+	}
+}